@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+
+	"github.com/exccrr/solidity-token-go-integration/game-server/address"
+	"github.com/exccrr/solidity-token-go-integration/game-server/ens"
+)
+
+// ensResolver is nil when ENS is turned off or has no registry on this
+// chain.
+var ensResolver *ens.Resolver
+
+// parseAddress parses the user-supplied address in field strictly. On
+// failure it writes a 400 saying what is wrong with it and returns false.
+func parseAddress(c *gin.Context, field, s string) (common.Address, bool) {
+	addr, err := address.ParseNonZero(s)
+	if err == nil {
+		return addr, true
+	}
+	code := "INVALID_ADDRESS"
+	switch {
+	case errors.Is(err, address.ErrChecksum):
+		code = "BAD_CHECKSUM"
+	case errors.Is(err, address.ErrZero):
+		code = "ZERO_ADDRESS"
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": field + ": " + err.Error(), "code": code})
+	return common.Address{}, false
+}
+
+// resolveAddress is parseAddress that also takes an ENS name such as
+// alice.eth and resolves it on the connected chain.
+func resolveAddress(c *gin.Context, field, s string) (common.Address, bool) {
+	if !ens.IsName(s) {
+		return parseAddress(c, field, s)
+	}
+	if ensResolver == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": field + ": ENS names are not supported on this network", "code": "ENS_DISABLED"})
+		return common.Address{}, false
+	}
+	addr, err := ensResolver.Resolve(c.Request.Context(), s)
+	switch {
+	case err == nil:
+		return addr, true
+	case errors.Is(err, ens.ErrInvalidName):
+		c.JSON(http.StatusBadRequest, gin.H{"error": field + ": " + err.Error(), "code": "INVALID_NAME"})
+	case errors.Is(err, ens.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": field + ": " + err.Error(), "code": "NAME_NOT_FOUND"})
+	default:
+		log.Println("ENS resolution failed:", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "ENS resolution failed", "code": "ENS_UNAVAILABLE"})
+	}
+	return common.Address{}, false
+}
+
+// displayName returns the verified primary ENS name of addr, or "".
+func displayName(ctx context.Context, addr common.Address) string {
+	if ensResolver == nil {
+		return ""
+	}
+	name, err := ensResolver.Lookup(ctx, addr)
+	if err != nil {
+		log.Println("ENS reverse lookup failed:", err)
+	}
+	return name
+}
@@ -0,0 +1,60 @@
+// Package address parses Ethereum addresses coming from users. Unlike
+// common.HexToAddress it never guesses: anything that is not exactly an
+// address is an error, and mixed-case input must carry a valid EIP-55
+// checksum.
+package address
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	// ErrMalformed is returned for anything but 0x followed by 40 hex
+	// digits.
+	ErrMalformed = errors.New("address must be 0x followed by 40 hex digits")
+	// ErrChecksum is returned for a mixed-case address whose case does not
+	// match its EIP-55 checksum, which usually means a typo.
+	ErrChecksum = errors.New("address fails its EIP-55 checksum")
+	// ErrZero is returned by ParseNonZero for the zero address.
+	ErrZero = errors.New("zero address not allowed")
+)
+
+// Parse returns the address s spells. All-lowercase and all-uppercase hex
+// carry no checksum and are accepted as is; use Hex on the result for the
+// canonical checksummed form.
+func Parse(s string) (common.Address, error) {
+	digits, ok := strings.CutPrefix(s, "0x")
+	if !ok {
+		digits, ok = strings.CutPrefix(s, "0X")
+	}
+	if !ok || len(digits) != 2*common.AddressLength || !isHex(digits) {
+		return common.Address{}, ErrMalformed
+	}
+	addr := common.HexToAddress(digits)
+	if digits != strings.ToLower(digits) && digits != strings.ToUpper(digits) && "0x"+digits != addr.Hex() {
+		return common.Address{}, ErrChecksum
+	}
+	return addr, nil
+}
+
+// ParseNonZero is Parse for places where the zero address can only be a
+// mistake, such as a recipient or a player.
+func ParseNonZero(s string) (common.Address, error) {
+	addr, err := Parse(s)
+	if err == nil && addr == (common.Address{}) {
+		return common.Address{}, ErrZero
+	}
+	return addr, err
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,61 @@
+package address
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// checksummed is a valid EIP-55 address with both cases in it.
+const checksummed = "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"
+
+func TestParse(t *testing.T) {
+	want := common.HexToAddress(checksummed)
+	tests := []struct {
+		name string
+		in   string
+		err  error
+	}{
+		{"checksummed", checksummed, nil},
+		{"all lower", strings.ToLower(checksummed), nil},
+		{"all upper", "0x" + strings.ToUpper(checksummed[2:]), nil},
+		{"upper prefix", "0X" + checksummed[2:], nil},
+		{"bad checksum", "0x5AAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", ErrChecksum},
+		{"no prefix", checksummed[2:], ErrMalformed},
+		{"too short", checksummed[:41], ErrMalformed},
+		{"too long", checksummed + "0", ErrMalformed},
+		{"not hex", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeg", ErrMalformed},
+		{"padded", " " + checksummed, ErrMalformed},
+		{"empty", "", ErrMalformed},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%s: Parse(%q) = %s, %v; want %v", tt.name, tt.in, got.Hex(), err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != want {
+			t.Errorf("%s: Parse(%q) = %s, %v; want %s", tt.name, tt.in, got.Hex(), err, want.Hex())
+		}
+	}
+}
+
+func TestParseNonZero(t *testing.T) {
+	zero := "0x0000000000000000000000000000000000000000"
+	if addr, err := Parse(zero); err != nil || addr != (common.Address{}) {
+		t.Fatalf("Parse(zero) = %s, %v; want the zero address", addr.Hex(), err)
+	}
+	if _, err := ParseNonZero(zero); !errors.Is(err, ErrZero) {
+		t.Fatalf("ParseNonZero(zero): got %v, want ErrZero", err)
+	}
+	if _, err := ParseNonZero("0x00"); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("ParseNonZero(0x00): got %v, want ErrMalformed", err)
+	}
+	if addr, err := ParseNonZero(checksummed); err != nil || addr.Hex() != checksummed {
+		t.Fatalf("ParseNonZero(%s) = %s, %v", checksummed, addr.Hex(), err)
+	}
+}
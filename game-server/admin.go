@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/exccrr/solidity-token-go-integration/game-server/amount"
+	"github.com/exccrr/solidity-token-go-integration/game-server/store"
+	"github.com/exccrr/solidity-token-go-integration/game-server/txmgr"
+)
+
+// adminKey holds the name of the authenticated admin in the gin context.
+const adminKey = "admin"
+
+// adminAuth only lets requests through that carry one of the admin tokens
+// as a bearer token. spec is a single token, known as "admin", or
+// comma-separated name:token pairs so the audit log can tell admins apart.
+// With no token configured the admin API is switched off.
+func adminAuth(spec string) gin.HandlerFunc {
+	tokens := map[string]string{}
+	for _, entry := range strings.Split(spec, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, token, ok := strings.Cut(entry, ":")
+		if !ok {
+			name, token = "admin", entry
+		}
+		if token != "" {
+			tokens[name] = token
+		}
+	}
+	return func(c *gin.Context) {
+		if len(tokens) == 0 {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin API disabled"})
+			return
+		}
+		got := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		for name, token := range tokens {
+			if subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1 {
+				c.Set(adminKey, name)
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+	}
+}
+
+// payoutsHandler lists bonus payouts. ?status=pending|paid|failed narrows
+// the list; pending covers owed and sent, failed covers dead-lettered ones.
+func payoutsHandler(c *gin.Context) {
+	bonuses, err := db.Bonuses()
+	if err != nil {
+		log.Println("Payout ledger read failed:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ledger unavailable"})
+		return
+	}
+
+	want := map[string][]string{
+		"pending": {store.BonusOwed, store.BonusSent},
+		"paid":    {store.BonusPaid},
+		"failed":  {store.BonusDead},
+	}
+	filter := c.Query("status")
+	statuses, ok := want[filter]
+	if filter != "" && !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, paid or failed"})
+		return
+	}
+
+	out := []payoutEntry{}
+	for _, b := range bonuses {
+		if filter == "" || contains(statuses, b.Status) {
+			out = append(out, payoutEntry{Bonus: b, Amount: units.ValueOf(b.Amount), TriggerURL: cfg.Link("tx", b.Trigger), TxURL: cfg.Link("tx", b.TxHash)})
+		}
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// payoutEntry is a ledger record with its amount in both forms and
+// explorer links for the winning and the mint transaction.
+type payoutEntry struct {
+	store.Bonus
+	Amount     *amount.Value `json:"amount"`
+	TriggerURL string        `json:"triggerUrl,omitempty"`
+	TxURL      string        `json:"txUrl,omitempty"`
+}
+
+func retryPayoutHandler(c *gin.Context) {
+	err := payoutEngine.Retry(c.Param("trigger"))
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "no such payout"})
+	case err != nil:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, gin.H{"trigger": c.Param("trigger"), "status": store.BonusOwed})
+	}
+}
+
+// withdrawHandler moves the Game's token balance to its owner, which must
+// be the server key.
+func withdrawHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	tx, err := send(ctx, txmgr.OpWithdraw, gameInstance.Withdraw)
+	if err != nil {
+		log.Println("Withdraw failed:", err)
+		respondTxError(c, "withdraw failed", err)
+		return
+	}
+	log.Println("Withdraw tx hash:", tx.Hash().Hex())
+
+	receipt, err := waitTx(ctx, tx)
+	if errors.Is(err, txmgr.ErrReverted) {
+		respondRevert(c, "withdraw failed", revertDecoder.Replay(ctx, client, nonces.Account(), tx, receipt))
+		return
+	}
+	if err != nil {
+		log.Println("Withdraw not confirmed:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "withdraw not confirmed", "txHash": tx.Hash().Hex()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"txHash":   receipt.TxHash.Hex(),
+		"txUrl":    cfg.Link("tx", receipt.TxHash.Hex()),
+		"withdraw": txmgr.Summarize(receipt),
+	})
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
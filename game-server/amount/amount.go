@@ -0,0 +1,141 @@
+// Package amount converts between token base units and the decimal
+// strings people read and type, using the token's own Decimals().
+package amount
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+)
+
+var (
+	// ErrSyntax is returned for anything but plain digits with an optional
+	// fractional part: no sign, exponent, spaces or separators.
+	ErrSyntax = errors.New("amount must be a plain decimal number")
+	// ErrPrecision is returned for an amount finer than the token's
+	// smallest unit.
+	ErrPrecision = errors.New("amount has more decimals than the token")
+)
+
+// Metadata is the part of the token binding a Unit is loaded from.
+type Metadata interface {
+	Decimals(opts *bind.CallOpts) (uint8, error)
+	Symbol(opts *bind.CallOpts) (string, error)
+}
+
+// Unit describes one token's amounts.
+type Unit struct {
+	Decimals uint8
+	Symbol   string
+	scale    *big.Int
+}
+
+// New returns the Unit of a token with the given decimals and symbol.
+func New(decimals uint8, symbol string) *Unit {
+	return &Unit{
+		Decimals: decimals,
+		Symbol:   symbol,
+		scale:    new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil),
+	}
+}
+
+// Load reads the token's decimals and symbol once.
+func Load(ctx context.Context, token Metadata) (*Unit, error) {
+	opts := &bind.CallOpts{Context: ctx}
+	decimals, err := token.Decimals(opts)
+	if err != nil {
+		return nil, fmt.Errorf("read decimals: %w", err)
+	}
+	symbol, err := token.Symbol(opts)
+	if err != nil {
+		return nil, fmt.Errorf("read symbol: %w", err)
+	}
+	return New(decimals, symbol), nil
+}
+
+// Parse converts a decimal token amount such as "12.5" into base units.
+// It is exact: anything below one base unit is an error, not rounded.
+func (u *Unit) Parse(s string) (*big.Int, error) {
+	if err := Check(s); err != nil {
+		return nil, err
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, ErrSyntax
+	}
+	r.Mul(r, new(big.Rat).SetInt(u.scale))
+	if !r.IsInt() {
+		return nil, fmt.Errorf("%w: %q, %s has %d", ErrPrecision, s, u.Symbol, u.Decimals)
+	}
+	return new(big.Int).Set(r.Num()), nil
+}
+
+// Check reports whether s has the syntax Parse accepts, without needing
+// to know the token.
+func Check(s string) error {
+	whole, frac, hasDot := strings.Cut(s, ".")
+	if whole == "" || (hasDot && frac == "") || !digits(whole) || !digits(frac) {
+		return fmt.Errorf("%w: %q", ErrSyntax, s)
+	}
+	return nil
+}
+
+func digits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Format renders base units as a decimal string without trailing zeros,
+// e.g. 12500000000000000000 with 18 decimals is "12.5".
+func (u *Unit) Format(v *big.Int) string {
+	if v == nil {
+		return ""
+	}
+	neg := v.Sign() < 0
+	q, r := new(big.Int).QuoRem(new(big.Int).Abs(v), u.scale, new(big.Int))
+	s := q.String()
+	if r.Sign() != 0 {
+		frac := fmt.Sprintf("%0*s", int(u.Decimals), r.String())
+		s += "." + strings.TrimRight(frac, "0")
+	}
+	if neg {
+		s = "-" + s
+	}
+	return s
+}
+
+// Value is an amount as the API returns it.
+type Value struct {
+	Raw       string `json:"raw"`
+	Formatted string `json:"formatted"`
+	Symbol    string `json:"symbol"`
+}
+
+// Value wraps base units for an API response.
+func (u *Unit) Value(v *big.Int) Value {
+	return Value{Raw: v.String(), Formatted: u.Format(v), Symbol: u.Symbol}
+}
+
+// ValueOf wraps a base-unit decimal string, as stored in the database. It
+// returns nil for an empty or unparsable string.
+func (u *Unit) ValueOf(raw string) *Value {
+	v, ok := new(big.Int).SetString(raw, 10)
+	if !ok {
+		return nil
+	}
+	val := u.Value(v)
+	return &val
+}
+
+// String is the formatted amount with its symbol, for logs.
+func (v Value) String() string {
+	return v.Formatted + " " + v.Symbol
+}
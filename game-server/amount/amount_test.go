@@ -0,0 +1,71 @@
+package amount
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		decimals uint8
+		in       string
+		want     string // base units; "" when err is set
+		err      error
+	}{
+		{18, "12.5", "12500000000000000000", nil},
+		{18, "0", "0", nil},
+		{18, "007", "7000000000000000000", nil},
+		{18, "0.000000000000000001", "1", nil},
+		{6, "1.123456", "1123456", nil},
+		{6, "1.1234560", "1123456", nil},
+		{6, "1.1234567", "", ErrPrecision},
+		{0, "42", "42", nil},
+		{0, "42.0", "42", nil},
+		{0, "42.5", "", ErrPrecision},
+		{18, ".5", "", ErrSyntax},
+		{18, "5.", "", ErrSyntax},
+		{18, ".", "", ErrSyntax},
+		{18, "", "", ErrSyntax},
+		{18, "-1", "", ErrSyntax},
+		{18, "+1", "", ErrSyntax},
+		{18, "1e3", "", ErrSyntax},
+		{18, "1E-3", "", ErrSyntax},
+		{18, "1 000", "", ErrSyntax},
+		{18, "1,5", "", ErrSyntax},
+		{18, "1.2.3", "", ErrSyntax},
+	}
+	for _, tt := range tests {
+		got, err := New(tt.decimals, "MTK").Parse(tt.in)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Parse(%q) with %d decimals: got %v, %v; want %v", tt.in, tt.decimals, got, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got.String() != tt.want {
+			t.Errorf("Parse(%q) with %d decimals = %v, %v; want %s", tt.in, tt.decimals, got, err, tt.want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		decimals uint8
+		in       string
+		want     string
+	}{
+		{18, "12500000000000000000", "12.5"},
+		{18, "1", "0.000000000000000001"},
+		{18, "0", "0"},
+		{18, "-1500000000000000000", "-1.5"},
+		{6, "1000000", "1"},
+		{0, "42", "42"},
+	}
+	for _, tt := range tests {
+		v, _ := new(big.Int).SetString(tt.in, 10)
+		if got := New(tt.decimals, "MTK").Format(v); got != tt.want {
+			t.Errorf("Format(%s) with %d decimals = %q, want %q", tt.in, tt.decimals, got, tt.want)
+		}
+	}
+}
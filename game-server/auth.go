@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/gin-gonic/gin"
+
+	"github.com/exccrr/solidity-token-go-integration/game-server/session"
+	"github.com/exccrr/solidity-token-go-integration/game-server/siwe"
+)
+
+const (
+	sessionCookie = "session"
+	callerKey     = "caller"
+)
+
+var (
+	siweVerifier *siwe.Verifier
+	sessions     *session.Issuer
+)
+
+type LoginRequest struct {
+	Message   string        `json:"message"`
+	Signature hexutil.Bytes `json:"signature"`
+}
+
+// nonceHandler hands out a sign-in nonce. With ?address= it also returns
+// the EIP-55 form of the address, which the message must use.
+func nonceHandler(c *gin.Context) {
+	resp := gin.H{
+		"nonce":   siweVerifier.Nonce(),
+		"domain":  siweVerifier.Domain,
+		"chainId": siweVerifier.ChainID,
+	}
+	if a := c.Query("address"); a != "" {
+		addr, ok := parseAddress(c, "address", a)
+		if !ok {
+			return
+		}
+		resp["address"] = addr.Hex()
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// loginHandler verifies a signed SIWE message and starts a session for its
+// address, both as a cookie and as a bearer token in the body.
+func loginHandler(c *gin.Context) {
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	msg, err := siweVerifier.Verify(req.Message, req.Signature, time.Now())
+	if err != nil {
+		status := http.StatusUnauthorized
+		if errors.Is(err, siwe.ErrMalformed) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	token, expires, err := sessions.Issue(msg.Address)
+	if err != nil {
+		log.Println("Session issue failed:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed"})
+		return
+	}
+	log.Println("Signed in:", msg.Address.Hex())
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(sessionCookie, token, int(time.Until(expires).Seconds()), "/", "", c.Request.TLS != nil, true)
+	resp := gin.H{"address": msg.Address.Hex(), "token": token, "expires": expires}
+	if name := displayName(c.Request.Context(), msg.Address); name != "" {
+		resp["name"] = name
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func logoutHandler(c *gin.Context) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(sessionCookie, "", -1, "/", "", c.Request.TLS != nil, true)
+	c.Status(http.StatusNoContent)
+}
+
+func meHandler(c *gin.Context) {
+	resp := gin.H{"address": caller(c).Hex()}
+	if name := displayName(c.Request.Context(), caller(c)); name != "" {
+		resp["name"] = name
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// sessionAuth resolves the caller from the session cookie or a bearer
+// token. Requests without a valid session go through anonymously.
+func sessionAuth(c *gin.Context) {
+	token, _ := c.Cookie(sessionCookie)
+	if bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+		token = bearer
+	}
+	if token != "" {
+		if addr, err := sessions.Parse(token); err == nil {
+			c.Set(callerKey, addr)
+		}
+	}
+	c.Next()
+}
+
+// requireSession rejects anonymous requests.
+func requireSession(c *gin.Context) {
+	if _, ok := c.Get(callerKey); !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "sign in first", "code": "UNAUTHENTICATED"})
+		return
+	}
+	c.Next()
+}
+
+// ownsParam only lets the request through if the caller is the address in
+// the named route parameter.
+func ownsParam(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		addr, ok := resolveAddress(c, name, c.Param(name))
+		if !ok || !requireCaller(c, addr) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// caller returns the signed-in address; requireSession must run first.
+func caller(c *gin.Context) common.Address {
+	addr, _ := c.Get(callerKey)
+	a, _ := addr.(common.Address)
+	return a
+}
+
+// requireCaller writes a 403 and returns false unless the caller is addr.
+func requireCaller(c *gin.Context, addr common.Address) bool {
+	if caller(c) != addr {
+		c.JSON(http.StatusForbidden, gin.H{"error": "signed in as a different address", "code": "NOT_OWNER"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/exccrr/solidity-token-go-integration/game-server/store"
+)
+
+// chainPlay collects the events emitted by one play transaction.
+type chainPlay struct {
+	bet types.Log
+	ev  *GameLog
+}
+
+// backfill rebuilds plays, streaks and bonus records from the Game and
+// Token events between from and to, and stores to as the event cursor so
+// live watching resumes on the next block.
+func backfill(ctx context.Context, from, to, chunk uint64) error {
+	log.Println("Backfilling blocks", from, "to", to)
+
+	plays := map[common.Hash]*chainPlay{}
+	var order []types.Log
+	var mints []types.Log
+
+	for start := from; start <= to; start += chunk {
+		end := start + chunk - 1
+		if end > to {
+			end = to
+		}
+		opts := &bind.FilterOpts{Start: start, End: &end, Context: ctx}
+
+		bets, err := gameInstance.FilterBetPlaced(opts, nil)
+		if err != nil {
+			return fmt.Errorf("BetPlaced %d-%d: %w", start, end, err)
+		}
+		for bets.Next() {
+			ev := bets.Event
+			plays[ev.Raw.TxHash] = &chainPlay{bet: ev.Raw, ev: &GameLog{
+				Address:     ev.Player.Hex(),
+				Guess:       int(ev.Guess),
+				Winning:     int(ev.Winning),
+				Result:      "submitted",
+				TxHash:      ev.Raw.TxHash.Hex(),
+				BlockNumber: ev.Raw.BlockNumber,
+			}}
+		}
+		if err := bets.Error(); err != nil {
+			return err
+		}
+
+		wins, err := gameInstance.FilterWin(opts, nil)
+		if err != nil {
+			return fmt.Errorf("Win %d-%d: %w", start, end, err)
+		}
+		for wins.Next() {
+			order = append(order, wins.Event.Raw)
+			if p, ok := plays[wins.Event.Raw.TxHash]; ok {
+				p.ev.Result = "win"
+				p.ev.Prize = wins.Event.Prize.String()
+			}
+		}
+		if err := wins.Error(); err != nil {
+			return err
+		}
+
+		losses, err := gameInstance.FilterLoss(opts, nil)
+		if err != nil {
+			return fmt.Errorf("Loss %d-%d: %w", start, end, err)
+		}
+		for losses.Next() {
+			order = append(order, losses.Event.Raw)
+			if p, ok := plays[losses.Event.Raw.TxHash]; ok {
+				p.ev.Result = "loss"
+				p.ev.Prize = "0"
+			}
+		}
+		if err := losses.Error(); err != nil {
+			return err
+		}
+
+		transfers, err := tokenInstance.FilterTransfer(opts, []common.Address{{}}, nil)
+		if err != nil {
+			return fmt.Errorf("Transfer %d-%d: %w", start, end, err)
+		}
+		for transfers.Next() {
+			mints = append(mints, transfers.Event.Raw)
+		}
+		if err := transfers.Error(); err != nil {
+			return err
+		}
+	}
+
+	if err := backfillPlays(plays); err != nil {
+		return err
+	}
+	mints, err := operatorMints(ctx, mints)
+	if err != nil {
+		return err
+	}
+	streaks, err := backfillStreaks(order, mints)
+	if err != nil {
+		return err
+	}
+
+	old, err := db.Streaks()
+	if err != nil {
+		return err
+	}
+	for player := range old {
+		if _, ok := streaks[player]; !ok {
+			streaks[player] = 0
+		}
+	}
+	for player, n := range streaks {
+		if err := db.SetStreak(player, n); err != nil {
+			return err
+		}
+	}
+
+	log.Println("Backfill done:", len(plays), "plays,", len(streaks), "players")
+	return db.SetCursor(eventCursor, to)
+}
+
+// backfillPlays stores the outcome of every play. Plays already recorded by
+// this server keep their submission details.
+func backfillPlays(plays map[common.Hash]*chainPlay) error {
+	sorted := make([]*chainPlay, 0, len(plays))
+	for _, p := range plays {
+		sorted = append(sorted, p)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return logBefore(sorted[i].bet, sorted[j].bet) })
+
+	for _, p := range sorted {
+		p.ev.BlockTime = blockTime(p.ev.BlockNumber)
+		p.ev.Timestamp = p.ev.BlockTime
+
+		err := db.UpdatePlay(p.bet.TxHash, func(entry *GameLog) {
+			entry.Winning = p.ev.Winning
+			entry.Result = p.ev.Result
+			entry.Prize = p.ev.Prize
+			entry.BlockNumber = p.ev.BlockNumber
+			entry.BlockTime = p.ev.BlockTime
+		})
+		if errors.Is(err, store.ErrNotFound) {
+			err = db.AddPlay(*p.ev)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillStreaks replays Win and Loss in chain order with the same rules as
+// the live handlers, and matches each completed streak to the operator mint
+// that paid it. A streak already on the ledger is matched only by its own
+// transactions. A streak with no matching mint is recorded as dead for an
+// admin to review: paying it automatically could pay a bonus twice.
+func backfillStreaks(order, mints []types.Log) (map[string]int, error) {
+	sort.Slice(order, func(i, j int) bool { return logBefore(order[i], order[j]) })
+	sort.Slice(mints, func(i, j int) bool { return logBefore(mints[i], mints[j]) })
+
+	streaks := map[string]int{}
+	triggers := map[string][]types.Log{}
+	for _, l := range order {
+		player := common.BytesToAddress(l.Topics[1].Bytes()).Hex()
+		if _, err := gameInstance.ParseWin(l); err != nil {
+			streaks[player] = 0
+			continue
+		}
+		var bonus bool
+		if streaks[player], bonus = winStreak(streaks[player]); bonus {
+			triggers[player] = append(triggers[player], l)
+		}
+	}
+
+	paid := map[string][]types.Log{}
+	for _, m := range mints {
+		to := common.BytesToAddress(m.Topics[2].Bytes()).Hex()
+		paid[to] = append(paid[to], m)
+	}
+
+	ledger, err := db.Bonuses()
+	if err != nil {
+		return nil, err
+	}
+	claimed := map[string]bool{}
+	for _, b := range ledger {
+		for _, h := range b.TxHashes() {
+			claimed[h] = true
+		}
+	}
+
+	for player, list := range triggers {
+		mintsFor := paid[player]
+		for _, trigger := range list {
+			id := bonusTrigger(trigger)
+			existing, err := db.Bonus(id)
+			known := err == nil
+			if err != nil && !errors.Is(err, store.ErrNotFound) {
+				return nil, err
+			}
+
+			// The ledger's own transactions identify a known payout;
+			// otherwise the earliest unclaimed mint after the trigger is the
+			// one that paid it.
+			match := -1
+			for i, m := range mintsFor {
+				hash := m.TxHash.Hex()
+				if known && slices.Contains(existing.TxHashes(), hash) ||
+					!known && !claimed[hash] && logBefore(trigger, m) {
+					match = i
+					break
+				}
+			}
+
+			var bonus store.Bonus
+			switch {
+			case match >= 0:
+				bonus = existing
+				if !known {
+					bonus = store.Bonus{
+						Trigger:   id,
+						Player:    player,
+						Amount:    cfg.BonusAmount.String(),
+						CreatedAt: blockTime(trigger.BlockNumber),
+					}
+				}
+				bonus.TxHash = mintsFor[match].TxHash.Hex()
+				bonus.Status = store.BonusPaid
+				bonus.LastError = ""
+				mintsFor = append(mintsFor[:match:match], mintsFor[match+1:]...)
+			case known:
+				// Don't clobber a payout the engine or an admin is handling.
+				continue
+			default:
+				bonus = store.Bonus{
+					Trigger:   id,
+					Player:    player,
+					Amount:    cfg.BonusAmount.String(),
+					Status:    store.BonusDead,
+					LastError: "needs review: found by backfill with no bonus mint on chain",
+					CreatedAt: blockTime(trigger.BlockNumber),
+				}
+			}
+			bonus.UpdatedAt = time.Now()
+			if err := db.PutBonus(bonus); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return streaks, nil
+}
+
+// operatorMints keeps the mints the operator account sent straight to the
+// Token, which is how bonuses are paid. Mints in the admin audit log, the
+// Token's initial supply and mints by other accounts are left out.
+func operatorMints(ctx context.Context, mints []types.Log) ([]types.Log, error) {
+	audit, err := db.Mints()
+	if err != nil {
+		return nil, err
+	}
+	admin := map[string]bool{}
+	for _, m := range audit {
+		if m.TxHash != "" {
+			admin[m.TxHash] = true
+		}
+	}
+
+	operator := common.HexToAddress(publicAddr)
+	senders := map[common.Hash]common.Address{}
+	var out []types.Log
+	for _, m := range mints {
+		if admin[m.TxHash.Hex()] {
+			continue
+		}
+		from, ok := senders[m.TxHash]
+		if !ok {
+			tx, _, err := client.TransactionByHash(ctx, m.TxHash)
+			if err != nil {
+				return nil, fmt.Errorf("read mint tx %s: %w", m.TxHash.Hex(), err)
+			}
+			if tx.To() != nil && *tx.To() == cfg.TokenAddress {
+				from, err = types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+				if err != nil {
+					return nil, fmt.Errorf("mint tx %s sender: %w", m.TxHash.Hex(), err)
+				}
+			}
+			senders[m.TxHash] = from
+		}
+		if from == operator {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+func logBefore(a, b types.Log) bool {
+	if a.BlockNumber != b.BlockNumber {
+		return a.BlockNumber < b.BlockNumber
+	}
+	return a.Index < b.Index
+}
+
+// backfillTarget returns the newest block that already has enough
+// confirmations to be final for the event pipeline.
+func backfillTarget(ctx context.Context, confirmations uint64) (uint64, error) {
+	head, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	n := head.Number.Uint64()
+	if confirmations > 1 && n >= confirmations-1 {
+		n -= confirmations - 1
+	}
+	return n, nil
+}
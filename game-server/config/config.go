@@ -0,0 +1,530 @@
+// Package config loads the server settings from a network profile, a YAML
+// file, the environment and command-line flags. Later sources win:
+// defaults, then the profile, then the file, then environment variables,
+// then flags.
+package config
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"gopkg.in/yaml.v3"
+
+	"github.com/exccrr/solidity-token-go-integration/game-server/address"
+	"github.com/exccrr/solidity-token-go-integration/game-server/amount"
+	"github.com/exccrr/solidity-token-go-integration/game-server/txmgr"
+)
+
+// Config holds every setting of the game server.
+type Config struct {
+	// Network is the name of the profile the settings started from.
+	Network string
+	// RPCURLs are tried in order until one answers on the right chain.
+	RPCURLs      []string
+	TokenAddress common.Address
+	GameAddress  common.Address
+	ChainID      uint64
+	ListenAddr   string
+	DeployBlock  uint64
+	DBPath       string
+	AdminToken   string
+	// ExplorerURL is a block-explorer template with {kind} and {id}.
+	ExplorerURL string
+	// TokenDeployBlock is where the supply breakdown starts looking for
+	// mints; 0 means DeployBlock.
+	TokenDeployBlock uint64
+
+	// Signer selects where the operator key lives: "key" reads
+	// $PRIVATE_KEY, "keystore" decrypts KeystorePath with the passphrase in
+	// KeystorePasswordFile, "clef" asks the external signer at ClefURL to
+	// sign for SignerAddress, "pkcs11" signs on the token PKCS11Token with
+	// the key pair PKCS11Key.
+	Signer               string
+	KeystorePath         string
+	KeystorePasswordFile string
+	ClefURL              string
+	SignerAddress        common.Address
+	PKCS11Module         string
+	PKCS11Token          string
+	PKCS11Key            string
+	PKCS11PINFile        string
+
+	// TokenBin is the Token build output the deployed code is compared
+	// against. IntegrityMode is "strict" or "read_only"; see package integrity.
+	TokenBin      string
+	IntegrityMode string
+
+	// BetAmount and BonusAmount are in token base units. Like the other
+	// token amounts they are nil until ResolveAmounts. BetAmount is not a
+	// setting: game.sol charges a fixed GameBet per play.
+	BetAmount   *big.Int
+	BonusAmount *big.Int
+
+	// MintMax caps one admin mint and MintWindowMax the admin mints in any
+	// MintWindow, in token base units.
+	MintMax       *big.Int
+	MintWindowMax *big.Int
+	MintWindow    time.Duration
+
+	// amounts holds the token amounts as configured, keyed by setting.
+	amounts map[string]string
+
+	TxConfirmations    uint64
+	TxTimeout          time.Duration
+	TxRebroadcastAfter time.Duration
+	EventConfirmations uint64
+	EventPollInterval  time.Duration
+	EventChunkSize     uint64
+	// IntentTTL is how long a play intent handed out by the server is valid.
+	IntentTTL time.Duration
+
+	// SIWEDomain is the domain sign-in messages must name; SessionSecret
+	// signs session tokens and is random per run when empty.
+	SIWEDomain    string
+	SessionSecret string
+	SessionTTL    time.Duration
+
+	// ENSRegistry is the ENS registry names are resolved through; the zero
+	// address turns ENS off. Answers are cached for ENSCacheTTL.
+	ENSRegistry common.Address
+	ENSCacheTTL time.Duration
+
+	// Fee caps in wei; nil means no cap.
+	MaxFee         *big.Int
+	MaxPriorityFee *big.Int
+	MaxBaseFee     *big.Int
+	FeeBumpPercent uint64
+	GasLimits      map[string]uint64
+}
+
+// setting ties one Config field to its YAML key, environment variable and
+// flag. The flag name is the key with dashes.
+type setting struct {
+	key   string
+	env   []string
+	def   string
+	usage string
+	set   func(c *Config, v string) error
+}
+
+var settings = []setting{
+	{"rpc_url", []string{"RPC_URL", "SEPOLIA_URL"}, "", "Ethereum JSON-RPC endpoints (ws:// or https://), comma-separated in order of preference", urlsSetter},
+	{"token_address", []string{"TOKEN_ADDRESS"}, "", "Token contract address", addressSetter(func(c *Config) *common.Address { return &c.TokenAddress })},
+	{"game_address", []string{"GAME_ADDRESS"}, "", "Game contract address", addressSetter(func(c *Config) *common.Address { return &c.GameAddress })},
+	{"chain_id", []string{"CHAIN_ID"}, "0", "expected chain ID of the node", uintSetter(func(c *Config) *uint64 { return &c.ChainID })},
+	{"listen_addr", []string{"LISTEN_ADDR"}, ":8080", "HTTP listen address", func(c *Config, v string) error { c.ListenAddr = v; return nil }},
+	{"deploy_block", []string{"GAME_DEPLOY_BLOCK"}, "0", "block the Game contract was deployed in", uintSetter(func(c *Config) *uint64 { return &c.DeployBlock })},
+	{"token_deploy_block", []string{"TOKEN_DEPLOY_BLOCK"}, "0", "block the Token contract was deployed in, for the supply breakdown (0 = deploy_block)", uintSetter(func(c *Config) *uint64 { return &c.TokenDeployBlock })},
+	{"db_path", []string{"DB_PATH"}, "game-server.db", "path of the bbolt database", func(c *Config, v string) error { c.DBPath = v; return nil }},
+	{"admin_token", []string{"ADMIN_TOKEN"}, "", "bearer token for /admin endpoints, or comma-separated name:token pairs", func(c *Config, v string) error { c.AdminToken = v; return nil }},
+	{"explorer_url", []string{"EXPLORER_URL"}, "", "block-explorer link template, e.g. https://etherscan.io/{kind}/{id}", func(c *Config, v string) error { c.ExplorerURL = v; return nil }},
+	{"signer", []string{"SIGNER"}, "key", "where the operator key lives: key, keystore, clef or pkcs11", func(c *Config, v string) error { c.Signer = v; return nil }},
+	{"keystore_path", []string{"KEYSTORE_PATH"}, "", "encrypted keystore JSON file for signer: keystore", func(c *Config, v string) error { c.KeystorePath = v; return nil }},
+	{"keystore_password_file", []string{"KEYSTORE_PASSWORD_FILE"}, "", "file holding the keystore passphrase", func(c *Config, v string) error { c.KeystorePasswordFile = v; return nil }},
+	{"clef_url", []string{"CLEF_URL"}, "", "external signer endpoint for signer: clef", func(c *Config, v string) error { c.ClefURL = v; return nil }},
+	{"pkcs11_module", []string{"PKCS11_MODULE"}, "", "PKCS#11 library for signer: pkcs11", func(c *Config, v string) error { c.PKCS11Module = v; return nil }},
+	{"pkcs11_token_label", []string{"PKCS11_TOKEN_LABEL"}, "", "label of the PKCS#11 token holding the key", func(c *Config, v string) error { c.PKCS11Token = v; return nil }},
+	{"pkcs11_key_label", []string{"PKCS11_KEY_LABEL"}, "", "CKA_LABEL of the secp256k1 key pair", func(c *Config, v string) error { c.PKCS11Key = v; return nil }},
+	{"pkcs11_pin_file", []string{"PKCS11_PIN_FILE"}, "", "file holding the token user PIN", func(c *Config, v string) error { c.PKCS11PINFile = v; return nil }},
+	{"signer_address", []string{"SIGNER_ADDRESS"}, "", "operator account the external signer signs for", addressSetter(func(c *Config) *common.Address { return &c.SignerAddress })},
+	{"token_bin", []string{"TOKEN_BIN"}, "build/Token.bin", "Token creation bytecode to compare the deployed code against, empty to skip", func(c *Config, v string) error { c.TokenBin = v; return nil }},
+	{"integrity_mode", []string{"INTEGRITY_MODE"}, "strict", "on a Token ownership mismatch: strict refuses to start, read_only serves reads only", func(c *Config, v string) error { c.IntegrityMode = v; return nil }},
+	{"bonus_amount", []string{"BONUS_AMOUNT"}, "50", "tokens minted for a three-win streak", tokenSetter("bonus_amount")},
+	{"mint_max", []string{"MINT_MAX"}, "1000", "most tokens one admin mint may create", tokenSetter("mint_max")},
+	{"mint_window_max", []string{"MINT_WINDOW_MAX"}, "10000", "most tokens admin mints may create per mint_window", tokenSetter("mint_window_max")},
+	{"mint_window", []string{"MINT_WINDOW"}, "24h", "rolling window for mint_window_max", durationSetter(func(c *Config) *time.Duration { return &c.MintWindow })},
+	{"tx_confirmations", []string{"TX_CONFIRMATIONS"}, "1", "blocks on top of a receipt before a transaction counts", uintSetter(func(c *Config) *uint64 { return &c.TxConfirmations })},
+	{"tx_timeout", []string{"TX_TIMEOUT"}, "2m", "how long to wait for each transaction", durationSetter(func(c *Config) *time.Duration { return &c.TxTimeout })},
+	{"tx_rebroadcast_after", []string{"TX_REBROADCAST_AFTER"}, "30s", "re-broadcast a pending transaction after this long", durationSetter(func(c *Config) *time.Duration { return &c.TxRebroadcastAfter })},
+	{"event_confirmations", []string{"EVENT_CONFIRMATIONS"}, "3", "blocks an event must be buried under before it counts", uintSetter(func(c *Config) *uint64 { return &c.EventConfirmations })},
+	{"event_poll_interval", []string{"EVENT_POLL_INTERVAL"}, "12s", "how often to check for new blocks when polling", durationSetter(func(c *Config) *time.Duration { return &c.EventPollInterval })},
+	{"event_chunk_size", []string{"EVENT_CHUNK_SIZE"}, "2000", "max block range per eth_getLogs request", uintSetter(func(c *Config) *uint64 { return &c.EventChunkSize })},
+	{"intent_ttl", []string{"INTENT_TTL"}, "5m", "how long a signed play intent stays valid", durationSetter(func(c *Config) *time.Duration { return &c.IntentTTL })},
+	{"siwe_domain", []string{"SIWE_DOMAIN"}, "localhost:8080", "host the frontend is served from, as named in sign-in messages", func(c *Config, v string) error { c.SIWEDomain = v; return nil }},
+	{"session_secret", []string{"SESSION_SECRET"}, "", "HMAC key for session tokens, random per run when empty", func(c *Config, v string) error { c.SessionSecret = v; return nil }},
+	{"session_ttl", []string{"SESSION_TTL"}, "24h", "how long a sign-in lasts", durationSetter(func(c *Config) *time.Duration { return &c.SessionTTL })},
+	{"ens_registry", []string{"ENS_REGISTRY"}, "0x00000000000C2E074eC69A0dFb2997BA6C7d2e1e", "ENS registry for player names, empty to turn ENS off", addressSetter(func(c *Config) *common.Address { return &c.ENSRegistry })},
+	{"ens_cache_ttl", []string{"ENS_CACHE_TTL"}, "5m", "how long resolved ENS names are cached", durationSetter(func(c *Config) *time.Duration { return &c.ENSCacheTTL })},
+	{"fee_max_gwei", []string{"FEE_MAX_GWEI"}, "", "max fee per gas in gwei", gweiSetter(func(c *Config) **big.Int { return &c.MaxFee })},
+	{"fee_max_priority_gwei", []string{"FEE_MAX_PRIORITY_GWEI"}, "", "max priority fee per gas in gwei", gweiSetter(func(c *Config) **big.Int { return &c.MaxPriorityFee })},
+	{"fee_max_base_gwei", []string{"FEE_MAX_BASE_GWEI"}, "", "refuse to send while the base fee is above this", gweiSetter(func(c *Config) **big.Int { return &c.MaxBaseFee })},
+	{"fee_bump_percent", []string{"FEE_BUMP_PERCENT"}, "15", "fee increase for each re-broadcast", uintSetter(func(c *Config) *uint64 { return &c.FeeBumpPercent })},
+	{"gas_limit_approve", []string{"GAS_LIMIT_APPROVE"}, "60000", "gas limit for approve, 0 = estimate", gasSetter("approve")},
+	{"gas_limit_play", []string{"GAS_LIMIT_PLAY"}, "150000", "gas limit for play, 0 = estimate", gasSetter("play")},
+	{"gas_limit_mint", []string{"GAS_LIMIT_MINT"}, "80000", "gas limit for mint, 0 = estimate", gasSetter("mint")},
+	{"gas_limit_withdraw", []string{"GAS_LIMIT_WITHDRAW"}, "80000", "gas limit for withdraw, 0 = estimate", gasSetter("withdraw")},
+}
+
+// Load builds the Config from defaults, the network profile named by
+// -network (or $NETWORK, or the file's network key), the YAML file named by
+// -config (or $CONFIG_FILE), the environment and the flags in args. Flags
+// not known to the config layer are left to fs, which must not have been
+// parsed yet.
+func Load(fs *flag.FlagSet, args []string) (*Config, error) {
+	path := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML config file")
+	network := fs.String("network", "", "network profile: "+ProfileNames()+" ($NETWORK, default "+DefaultNetwork+")")
+	flagValues := make(map[string]*string, len(settings))
+	for _, s := range settings {
+		usage := s.usage
+		if len(s.env) > 0 {
+			usage += " ($" + s.env[0] + ")"
+		}
+		flagValues[s.key] = fs.String(flagName(s.key), "", usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	var file map[string]string
+	if *path != "" {
+		var err error
+		if file, err = readFile(*path); err != nil {
+			return nil, err
+		}
+	}
+
+	name, explicit := *network, isSet(fs, "network")
+	if !explicit {
+		if v, ok := os.LookupEnv("NETWORK"); ok {
+			name, explicit = v, true
+		} else if v, ok := file["network"]; ok {
+			name, explicit = v, true
+		}
+	}
+	delete(file, "network")
+	if !explicit {
+		name = DefaultNetwork
+	}
+
+	c := &Config{Network: name, GasLimits: map[string]uint64{}, amounts: map[string]string{}}
+	for _, s := range settings {
+		if err := apply(c, s, s.def, "default"); err != nil {
+			return nil, err
+		}
+	}
+
+	// An explicitly empty network means no profile at all.
+	if name != "" {
+		profile, ok := Profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown network %q (known: %s)", name, ProfileNames())
+		}
+		for _, s := range settings {
+			if v, ok := profile[s.key]; ok {
+				if err := apply(c, s, v, "network "+name); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := file[s.key]; ok {
+			if err := apply(c, s, v, *path); err != nil {
+				return nil, err
+			}
+			delete(file, s.key)
+		}
+	}
+	if len(file) > 0 {
+		unknown := make([]string, 0, len(file))
+		for k := range file {
+			unknown = append(unknown, k)
+		}
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("%s: unknown settings %s", *path, strings.Join(unknown, ", "))
+	}
+
+	for _, s := range settings {
+		for _, env := range s.env {
+			if v, ok := os.LookupEnv(env); ok && v != "" {
+				if err := apply(c, s, v, "$"+env); err != nil {
+					return nil, err
+				}
+				break
+			}
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if flagErr == nil && flagName(s.key) == f.Name {
+				flagErr = apply(c, s, *flagValues[s.key], "-"+f.Name)
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, flagErr
+	}
+	return c, c.Validate()
+}
+
+// Validate checks the settings that can be checked without a node.
+func (c *Config) Validate() error {
+	var errs []error
+	if len(c.RPCURLs) == 0 {
+		errs = append(errs, errors.New("rpc_url is required"))
+	}
+	if c.TokenAddress == (common.Address{}) {
+		errs = append(errs, errors.New("token_address is required"))
+	}
+	if c.GameAddress == (common.Address{}) {
+		errs = append(errs, errors.New("game_address is required"))
+	}
+	if c.TokenAddress != (common.Address{}) && c.TokenAddress == c.GameAddress {
+		errs = append(errs, errors.New("token_address and game_address must differ"))
+	}
+	if c.ChainID == 0 {
+		errs = append(errs, errors.New("chain_id is required"))
+	}
+	if c.DeployBlock == 0 && !c.StartsEmpty() {
+		errs = append(errs, fmt.Errorf("deploy_block is required on %s; backfills and the supply breakdown would otherwise scan from genesis", c.Network))
+	}
+	switch c.Signer {
+	case "key":
+	case "keystore":
+		if c.KeystorePath == "" || c.KeystorePasswordFile == "" {
+			errs = append(errs, errors.New("signer keystore needs keystore_path and keystore_password_file"))
+		}
+	case "clef":
+		if c.ClefURL == "" || c.SignerAddress == (common.Address{}) {
+			errs = append(errs, errors.New("signer clef needs clef_url and signer_address"))
+		}
+	case "pkcs11":
+		if c.PKCS11Module == "" || c.PKCS11Token == "" || c.PKCS11Key == "" || c.PKCS11PINFile == "" {
+			errs = append(errs, errors.New("signer pkcs11 needs pkcs11_module, pkcs11_token_label, pkcs11_key_label and pkcs11_pin_file"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("signer must be key, keystore, clef or pkcs11, got %q", c.Signer))
+	}
+	if c.IntegrityMode != "strict" && c.IntegrityMode != "read_only" {
+		errs = append(errs, fmt.Errorf("integrity_mode must be strict or read_only, got %q", c.IntegrityMode))
+	}
+	if c.EventChunkSize == 0 {
+		errs = append(errs, errors.New("event_chunk_size must be positive"))
+	}
+	for _, d := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"event_poll_interval", c.EventPollInterval},
+		{"mint_window", c.MintWindow},
+		{"session_ttl", c.SessionTTL},
+		{"intent_ttl", c.IntentTTL},
+	} {
+		if d.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive, got %s", d.key, d.value))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// GameBet is the bet game.sol takes per play, in whole tokens. The contract
+// does not expose it, so it is fixed here rather than configurable.
+const GameBet = "10"
+
+// ResolveAmounts converts the configured token amounts into base units of
+// the token described by u. It runs once the token's decimals are known.
+func (c *Config) ResolveAmounts(u *amount.Unit) error {
+	fields := map[string]**big.Int{
+		"bonus_amount":    &c.BonusAmount,
+		"mint_max":        &c.MintMax,
+		"mint_window_max": &c.MintWindowMax,
+	}
+	var errs []error
+	for key, field := range fields {
+		v, err := u.Parse(c.amounts[key])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			continue
+		}
+		*field = v
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	for key, field := range fields {
+		if (*field).Sign() <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", key))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	bet, err := u.Parse(GameBet)
+	if err != nil {
+		return err
+	}
+	c.BetAmount = bet
+	return nil
+}
+
+// Chain is what CheckChain needs from the node.
+type Chain interface {
+	ChainID(ctx context.Context) (*big.Int, error)
+	CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error)
+}
+
+// CheckChain verifies that the node is on the configured chain and that
+// both contracts are deployed there.
+func (c *Config) CheckChain(ctx context.Context, chain Chain) error {
+	id, err := chain.ChainID(ctx)
+	if err != nil {
+		return fmt.Errorf("read chain ID: %w", err)
+	}
+	if id.Uint64() != c.ChainID {
+		return fmt.Errorf("node is on chain %s, config expects %d", id, c.ChainID)
+	}
+
+	var errs []error
+	for name, addr := range map[string]common.Address{"token": c.TokenAddress, "game": c.GameAddress} {
+		code, err := chain.CodeAt(ctx, addr, nil)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("read %s code: %w", name, err))
+			continue
+		}
+		if len(code) == 0 {
+			errs = append(errs, fmt.Errorf("no contract code at %s address %s on chain %d", name, addr.Hex(), c.ChainID))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func apply(c *Config, s setting, v, source string) error {
+	if err := s.set(c, v); err != nil {
+		return fmt.Errorf("%s from %s: %w", s.key, source, err)
+	}
+	return nil
+}
+
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	out := make(map[string]string, len(raw))
+	for k, v := range raw {
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+			return nil, fmt.Errorf("%s: %s must be a scalar", path, k)
+		case nil:
+			out[k] = ""
+		default:
+			out[k] = fmt.Sprint(v)
+		}
+	}
+	return out, nil
+}
+
+func isSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func flagName(key string) string {
+	return strings.ReplaceAll(key, "_", "-")
+}
+
+func urlsSetter(c *Config, v string) error {
+	c.RPCURLs = nil
+	for _, u := range strings.Split(v, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			c.RPCURLs = append(c.RPCURLs, u)
+		}
+	}
+	return nil
+}
+
+func addressSetter(field func(*Config) *common.Address) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		if v == "" {
+			*field(c) = common.Address{}
+			return nil
+		}
+		addr, err := address.Parse(v)
+		if err != nil {
+			return fmt.Errorf("%q: %w", v, err)
+		}
+		*field(c) = addr
+		return nil
+	}
+}
+
+func uintSetter(field func(*Config) *uint64) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func durationSetter(field func(*Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+// tokenSetter only checks the syntax of a token amount; ResolveAmounts
+// converts it once the token's decimals are known.
+func tokenSetter(key string) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		if err := amount.Check(v); err != nil {
+			return err
+		}
+		c.amounts[key] = v
+		return nil
+	}
+}
+
+func gweiSetter(field func(*Config) **big.Int) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		if v == "" {
+			*field(c) = nil
+			return nil
+		}
+		wei, err := txmgr.ParseGwei(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = wei
+		return nil
+	}
+}
+
+func gasSetter(op string) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		c.GasLimits[op] = n
+		return nil
+	}
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// validConfig returns settings that pass Validate.
+func validConfig() *Config {
+	return &Config{
+		Network:           "sepolia",
+		RPCURLs:           []string{"https://rpc.example"},
+		TokenAddress:      common.HexToAddress("0x1111111111111111111111111111111111111111"),
+		GameAddress:       common.HexToAddress("0x2222222222222222222222222222222222222222"),
+		ChainID:           11155111,
+		DeployBlock:       100,
+		Signer:            "key",
+		IntegrityMode:     "strict",
+		EventChunkSize:    2000,
+		EventPollInterval: 12 * time.Second,
+		MintWindow:        24 * time.Hour,
+		SessionTTL:        24 * time.Hour,
+		IntentTTL:         5 * time.Minute,
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   string // "" for valid
+	}{
+		{"valid", func(c *Config) {}, ""},
+		{"zero poll interval", func(c *Config) { c.EventPollInterval = 0 }, "event_poll_interval must be positive"},
+		{"negative poll interval", func(c *Config) { c.EventPollInterval = -time.Second }, "event_poll_interval must be positive"},
+		{"zero mint window", func(c *Config) { c.MintWindow = 0 }, "mint_window must be positive"},
+		{"negative mint window", func(c *Config) { c.MintWindow = -time.Hour }, "mint_window must be positive"},
+		{"zero session ttl", func(c *Config) { c.SessionTTL = 0 }, "session_ttl must be positive"},
+		{"negative intent ttl", func(c *Config) { c.IntentTTL = -time.Minute }, "intent_ttl must be positive"},
+		{"zero chunk size", func(c *Config) { c.EventChunkSize = 0 }, "event_chunk_size must be positive"},
+		{"same addresses", func(c *Config) { c.GameAddress = c.TokenAddress }, "must differ"},
+		{"no deploy block", func(c *Config) { c.DeployBlock = 0 }, "deploy_block is required"},
+		{"hardhat without deploy block", func(c *Config) { c.Network, c.DeployBlock = "hardhat", 0 }, ""},
+		{"unknown signer", func(c *Config) { c.Signer = "ledger" }, "signer must be"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig()
+			tt.change(c)
+			err := c.Validate()
+			switch {
+			case tt.want == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.want != "" && err == nil:
+				t.Fatalf("accepted, want %q", tt.want)
+			case tt.want != "" && !strings.Contains(err.Error(), tt.want):
+				t.Fatalf("got %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
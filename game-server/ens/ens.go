@@ -0,0 +1,211 @@
+// Package ens resolves ENS names to addresses, and addresses to their
+// primary names, with plain contract calls on the connected chain: the
+// registry's resolver(node), then the resolver's addr(node) or name(node).
+// Wildcard (ENSIP-10) and off-chain (CCIP-read) resolution are not
+// supported.
+package ens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	// ErrInvalidName is returned for a name this package cannot normalise.
+	ErrInvalidName = errors.New("invalid ENS name")
+	// ErrNotFound is returned when a name has no resolver or no address.
+	ErrNotFound = errors.New("ENS name not found")
+)
+
+// The registry, resolver and reverse-resolver functions that are called.
+const ensABI = `[
+	{"type":"function","name":"resolver","stateMutability":"view","inputs":[{"name":"node","type":"bytes32"}],"outputs":[{"name":"","type":"address"}]},
+	{"type":"function","name":"addr","stateMutability":"view","inputs":[{"name":"node","type":"bytes32"}],"outputs":[{"name":"","type":"address"}]},
+	{"type":"function","name":"name","stateMutability":"view","inputs":[{"name":"node","type":"bytes32"}],"outputs":[{"name":"","type":"string"}]}
+]`
+
+// IsName reports whether s is meant as an ENS name rather than an address.
+func IsName(s string) bool {
+	return strings.Contains(s, ".")
+}
+
+// Normalize lowercases name and checks that it is made of non-empty labels
+// of ASCII letters, digits, hyphens and underscores. Full ENSIP-15
+// normalisation, and with it non-ASCII names, is not supported.
+func Normalize(name string) (string, error) {
+	name = strings.ToLower(name)
+	for _, label := range strings.Split(name, ".") {
+		if label == "" {
+			return "", fmt.Errorf("%w %q: empty label", ErrInvalidName, name)
+		}
+		for _, c := range label {
+			if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_') {
+				return "", fmt.Errorf("%w %q: unsupported character %q", ErrInvalidName, name, c)
+			}
+		}
+	}
+	return name, nil
+}
+
+// NameHash is the EIP-137 namehash of a normalised name.
+func NameHash(name string) common.Hash {
+	var node common.Hash
+	if name == "" {
+		return node
+	}
+	labels := strings.Split(name, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		node = crypto.Keccak256Hash(node[:], crypto.Keccak256([]byte(labels[i])))
+	}
+	return node
+}
+
+type cached[T any] struct {
+	value   T
+	expires time.Time
+}
+
+// Resolver resolves names through one registry and caches the answers,
+// including negative ones, for TTL. Errors are not cached.
+type Resolver struct {
+	TTL time.Duration
+
+	caller   bind.ContractCaller
+	abi      abi.ABI
+	registry *bind.BoundContract
+
+	mu      sync.Mutex
+	forward map[string]cached[common.Address]
+	reverse map[common.Address]cached[string]
+}
+
+// New returns a Resolver using the registry at registry, which must have
+// code on the connected chain.
+func New(ctx context.Context, caller bind.ContractCaller, registry common.Address, ttl time.Duration) (*Resolver, error) {
+	parsed, err := abi.JSON(strings.NewReader(ensABI))
+	if err != nil {
+		return nil, err
+	}
+	code, err := caller.CodeAt(ctx, registry, nil)
+	if err != nil {
+		return nil, fmt.Errorf("read registry code: %w", err)
+	}
+	if len(code) == 0 {
+		return nil, fmt.Errorf("no ENS registry at %s", registry.Hex())
+	}
+	return &Resolver{
+		TTL:      ttl,
+		caller:   caller,
+		abi:      parsed,
+		registry: bind.NewBoundContract(registry, parsed, caller, nil, nil),
+		forward:  make(map[string]cached[common.Address]),
+		reverse:  make(map[common.Address]cached[string]),
+	}, nil
+}
+
+// Resolve returns the address name points to.
+func (r *Resolver) Resolve(ctx context.Context, name string) (common.Address, error) {
+	name, err := Normalize(name)
+	if err != nil {
+		return common.Address{}, err
+	}
+	r.mu.Lock()
+	c, ok := r.forward[name]
+	r.mu.Unlock()
+	if !ok || time.Now().After(c.expires) {
+		addr, err := r.addr(ctx, NameHash(name))
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return common.Address{}, err
+		}
+		c = cached[common.Address]{value: addr, expires: time.Now().Add(r.TTL)}
+		r.mu.Lock()
+		r.forward[name] = c
+		r.mu.Unlock()
+	}
+	if c.value == (common.Address{}) {
+		return common.Address{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return c.value, nil
+}
+
+// Lookup returns the primary name of addr, or "" if it has none. A name is
+// only returned if it also resolves back to addr, since anyone can point
+// the reverse record of their own address at any name.
+func (r *Resolver) Lookup(ctx context.Context, addr common.Address) (string, error) {
+	r.mu.Lock()
+	c, ok := r.reverse[addr]
+	r.mu.Unlock()
+	if ok && time.Now().Before(c.expires) {
+		return c.value, nil
+	}
+
+	name, err := r.name(ctx, addr)
+	if err != nil {
+		return "", err
+	}
+	if name != "" {
+		forward, err := r.Resolve(ctx, name)
+		switch {
+		case err == nil && forward == addr:
+		case err == nil, errors.Is(err, ErrNotFound), errors.Is(err, ErrInvalidName):
+			name = ""
+		default:
+			return "", err
+		}
+	}
+	r.mu.Lock()
+	r.reverse[addr] = cached[string]{value: name, expires: time.Now().Add(r.TTL)}
+	r.mu.Unlock()
+	return name, nil
+}
+
+// resolver returns the resolver set for node in the registry.
+func (r *Resolver) resolver(ctx context.Context, node common.Hash) (*bind.BoundContract, error) {
+	var out []interface{}
+	if err := r.registry.Call(&bind.CallOpts{Context: ctx}, &out, "resolver", node); err != nil {
+		return nil, fmt.Errorf("registry resolver: %w", err)
+	}
+	addr := *abi.ConvertType(out[0], new(common.Address)).(*common.Address)
+	if addr == (common.Address{}) {
+		return nil, ErrNotFound
+	}
+	return bind.NewBoundContract(addr, r.abi, r.caller, nil, nil), nil
+}
+
+func (r *Resolver) addr(ctx context.Context, node common.Hash) (common.Address, error) {
+	res, err := r.resolver(ctx, node)
+	if err != nil {
+		return common.Address{}, err
+	}
+	var out []interface{}
+	if err := res.Call(&bind.CallOpts{Context: ctx}, &out, "addr", node); err != nil {
+		return common.Address{}, fmt.Errorf("resolver addr: %w", err)
+	}
+	return *abi.ConvertType(out[0], new(common.Address)).(*common.Address), nil
+}
+
+// name reads the reverse record of addr, under <hex>.addr.reverse.
+func (r *Resolver) name(ctx context.Context, addr common.Address) (string, error) {
+	node := NameHash(strings.ToLower(addr.Hex()[2:]) + ".addr.reverse")
+	res, err := r.resolver(ctx, node)
+	if errors.Is(err, ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var out []interface{}
+	if err := res.Call(&bind.CallOpts{Context: ctx}, &out, "name", node); err != nil {
+		return "", fmt.Errorf("resolver name: %w", err)
+	}
+	return *abi.ConvertType(out[0], new(string)).(*string), nil
+}
@@ -0,0 +1,142 @@
+package ens
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+)
+
+// recordsCode is the runtime code of a stand-in registry and resolver: a
+// call returns the three storage words at keccak256(selector ++ node) and
+// the two slots after it, which is enough for an address or a short
+// string result.
+//
+//	calldatacopy(0, 0, 36)
+//	base := keccak256(0, 36)
+//	mstore(0x00, sload(base))
+//	mstore(0x20, sload(base+1))
+//	mstore(0x40, sload(base+2))
+//	return(0, 0x60)
+var recordsCode = common.FromHex("0x" +
+	"6024600060003760246000208054600052806001015460205260020154604052" +
+	"60606000f3")
+
+// records is the storage of a contract running recordsCode.
+type records map[common.Hash]common.Hash
+
+func (r records) set(fn string, node common.Hash, words ...common.Hash) {
+	key := crypto.Keccak256(crypto.Keccak256([]byte(fn))[:4], node[:])
+	base := new(big.Int).SetBytes(key)
+	for i, w := range words {
+		slot := new(big.Int).Add(base, big.NewInt(int64(i)))
+		r[common.BigToHash(slot)] = w
+	}
+}
+
+func (r records) setAddress(fn string, node common.Hash, addr common.Address) {
+	r.set(fn, node, common.BytesToHash(addr.Bytes()))
+}
+
+func (r records) setString(fn string, node common.Hash, s string) {
+	var data common.Hash
+	copy(data[:], s)
+	r.set(fn, node, common.BigToHash(big.NewInt(32)), common.BigToHash(big.NewInt(int64(len(s)))), data)
+}
+
+func reverseNode(addr common.Address) common.Hash {
+	return NameHash(common.Bytes2Hex(addr.Bytes()) + ".addr.reverse")
+}
+
+var (
+	registryAddr = common.HexToAddress("0x00000000000C2E074eC69A0dFb2997BA6C7d2e1e")
+	resolverAddr = common.HexToAddress("0x4976fb03C32e5B8cfe2b6cCB31c09Ba78EBaBa41")
+	alice        = common.HexToAddress("0x1111111111111111111111111111111111111111")
+	mallory      = common.HexToAddress("0x2222222222222222222222222222222222222222")
+)
+
+// newTestResolver starts a simulated chain where alice.eth points to alice
+// and both alice and mallory claim alice.eth as their primary name.
+func newTestResolver(t *testing.T) *Resolver {
+	t.Helper()
+	registry, resolver := records{}, records{}
+	for _, node := range []common.Hash{NameHash("alice.eth"), reverseNode(alice), reverseNode(mallory)} {
+		registry.setAddress("resolver(bytes32)", node, resolverAddr)
+	}
+	resolver.setAddress("addr(bytes32)", NameHash("alice.eth"), alice)
+	resolver.setString("name(bytes32)", reverseNode(alice), "alice.eth")
+	resolver.setString("name(bytes32)", reverseNode(mallory), "alice.eth")
+
+	sim := simulated.NewBackend(types.GenesisAlloc{
+		registryAddr: {Code: recordsCode, Storage: registry, Balance: new(big.Int)},
+		resolverAddr: {Code: recordsCode, Storage: resolver, Balance: new(big.Int)},
+	})
+	t.Cleanup(func() { sim.Close() })
+
+	r, err := New(context.Background(), sim.Client(), registryAddr, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestResolve(t *testing.T) {
+	r := newTestResolver(t)
+	ctx := context.Background()
+
+	got, err := r.Resolve(ctx, "Alice.ETH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != alice {
+		t.Fatalf("alice.eth resolved to %s, want %s", got.Hex(), alice.Hex())
+	}
+	if _, err := r.Resolve(ctx, "bob.eth"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("bob.eth: got %v, want ErrNotFound", err)
+	}
+	if _, err := r.Resolve(ctx, "bad..eth"); !errors.Is(err, ErrInvalidName) {
+		t.Fatalf("bad..eth: got %v, want ErrInvalidName", err)
+	}
+}
+
+func TestLookupVerifiesForward(t *testing.T) {
+	r := newTestResolver(t)
+	ctx := context.Background()
+
+	name, err := r.Lookup(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "alice.eth" {
+		t.Fatalf("alice's primary name is %q, want alice.eth", name)
+	}
+
+	// mallory's reverse record claims alice.eth, which resolves elsewhere.
+	name, err = r.Lookup(ctx, mallory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "" {
+		t.Fatalf("mallory shown as %q", name)
+	}
+
+	// No reverse record at all.
+	name, err = r.Lookup(ctx, common.HexToAddress("0x3333333333333333333333333333333333333333"))
+	if err != nil || name != "" {
+		t.Fatalf("got %q, %v for an address without a name", name, err)
+	}
+}
+
+func TestNewNeedsRegistryCode(t *testing.T) {
+	sim := simulated.NewBackend(types.GenesisAlloc{})
+	defer sim.Close()
+	if _, err := New(context.Background(), sim.Client(), registryAddr, time.Minute); err == nil {
+		t.Fatal("accepted a registry address without code")
+	}
+}
@@ -0,0 +1,393 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+type blockLogKey struct {
+	block common.Hash
+	tx    common.Hash
+	index uint
+}
+
+func keyOf(l types.Log) blockLogKey {
+	return blockLogKey{block: l.BlockHash, tx: l.TxHash, index: l.Index}
+}
+
+// Confirmer holds logs back until their block has the configured number of
+// confirmations, and only releases logs whose block is still canonical.
+//
+// It keeps the hashes of recent headers and checks each new header's parent
+// against them. When they disagree it walks back to the fork point, throws
+// away unconfirmed logs above it, re-sends already released logs above it to
+// the handler with Removed set so derived state can be rolled back, and
+// refetches the logs of the new branch. Removed logs delivered by a
+// subscription are handled the same way.
+//
+// A log whose handler fails holds its block back, unreleased, and is handed
+// on again by the next Advance.
+type Confirmer struct {
+	source    Source
+	addresses []common.Address
+	depth     uint64
+	handle    HandleFunc
+
+	// Retention is how many released blocks are remembered for rollback.
+	Retention uint64
+	// OnAdvance, if set, is called with the new release height whenever
+	// Advance moves it, so the caller can persist it as a resume point.
+	OnAdvance func(released uint64)
+	// Fetched, if set, returns the highest block whose logs have all been
+	// passed to Add. Nothing above it is released, so logs a lagging
+	// watcher has yet to fetch cannot be overtaken.
+	Fetched func() uint64
+
+	mu       sync.Mutex
+	headers  map[uint64]common.Hash
+	tip      uint64
+	released uint64
+	pending  map[uint64][]types.Log
+	applied  map[uint64][]types.Log
+	known    map[blockLogKey]bool
+	// late holds logs for blocks already released that were not part of
+	// the release, until Advance has checked them against the chain.
+	late []types.Log
+}
+
+// NewConfirmer returns a Confirmer that releases logs to handle once they
+// are depth blocks deep. Blocks up to and including from count as already
+// released.
+func NewConfirmer(source Source, addresses []common.Address, depth uint64, from uint64, handle HandleFunc) *Confirmer {
+	if depth == 0 {
+		depth = 1
+	}
+	return &Confirmer{
+		source:    source,
+		addresses: addresses,
+		depth:     depth,
+		handle:    handle,
+		Retention: 128,
+		headers:   make(map[uint64]common.Hash),
+		released:  from,
+		pending:   make(map[uint64][]types.Log),
+		applied:   make(map[uint64][]types.Log),
+		known:     make(map[blockLogKey]bool),
+	}
+}
+
+// Released returns the highest block whose logs have been handed on.
+func (c *Confirmer) Released() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.released
+}
+
+// Add queues a log from the watcher. It has the HandleFunc signature so it
+// can be plugged in directly.
+func (c *Confirmer) Add(l types.Log) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := keyOf(l)
+	if l.Removed {
+		c.removeLocked(l.BlockNumber, key)
+		return nil
+	}
+	if c.known[key] {
+		return nil
+	}
+	c.known[key] = true
+
+	if l.BlockNumber <= c.released {
+		// Late arrival for a block we already released, e.g. a refetch
+		// racing the subscription. It is never dropped unseen: Advance
+		// applies it if its block is still canonical.
+		c.late = append(c.late, l)
+		return nil
+	}
+	c.pending[l.BlockNumber] = append(c.pending[l.BlockNumber], l)
+	return nil
+}
+
+// Run calls Advance every interval until ctx is cancelled.
+func (c *Confirmer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := c.Advance(ctx); err != nil && ctx.Err() == nil {
+			log.Println("Confirmation check failed:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Advance follows the head, handles any reorg and releases every block that
+// now has enough confirmations.
+func (c *Confirmer) Advance(ctx context.Context) error {
+	// Read before the head so every log up to fetched is already queued.
+	fetched := uint64(math.MaxUint64)
+	if c.Fetched != nil {
+		fetched = c.Fetched()
+	}
+	head, err := c.source.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return err
+	}
+	headNum := head.Number.Uint64()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	before := c.released
+	if err := c.syncHeadersLocked(ctx, headNum); err != nil {
+		return err
+	}
+	if err := c.applyLateLocked(ctx); err != nil {
+		return err
+	}
+
+release:
+	for b := c.released + 1; b+c.depth-1 <= headNum && b <= fetched; b++ {
+		logs := c.pending[b]
+		sort.Slice(logs, func(i, j int) bool { return logs[i].Index < logs[j].Index })
+		for i, l := range logs {
+			if hash, ok := c.headers[b]; ok && hash != l.BlockHash {
+				delete(c.known, keyOf(l))
+				continue
+			}
+			if err := c.applyLocked(l); err != nil {
+				// The block stays unreleased, with the failed log and
+				// the ones after it, until the next Advance.
+				log.Println("Event handler error:", err, "- retrying block", b)
+				c.pending[b] = logs[i:]
+				break release
+			}
+		}
+		delete(c.pending, b)
+		c.released = b
+	}
+
+	c.pruneLocked()
+	if c.OnAdvance != nil && c.released != before {
+		c.OnAdvance(c.released)
+	}
+	return nil
+}
+
+// applyLateLocked applies the late logs whose block is still canonical and
+// drops the rest. A late log whose handler fails stays queued and stops the
+// Advance, so it is retried first next time. Logs above the release height after a rollback go back to
+// waiting for confirmations.
+func (c *Confirmer) applyLateLocked(ctx context.Context) error {
+	for len(c.late) > 0 {
+		l := c.late[0]
+		if l.BlockNumber > c.released {
+			c.pending[l.BlockNumber] = append(c.pending[l.BlockNumber], l)
+			c.late = c.late[1:]
+			continue
+		}
+		hash, ok := c.headers[l.BlockNumber]
+		if !ok {
+			header, err := c.source.HeaderByNumber(ctx, new(big.Int).SetUint64(l.BlockNumber))
+			if err != nil {
+				return err
+			}
+			hash = header.Hash()
+		}
+		if hash == l.BlockHash {
+			if err := c.applyLocked(l); err != nil {
+				return fmt.Errorf("late log in block %d: %w", l.BlockNumber, err)
+			}
+		} else {
+			delete(c.known, keyOf(l))
+		}
+		c.late = c.late[1:]
+	}
+	return nil
+}
+
+// syncHeadersLocked records canonical header hashes up to head and rolls
+// back to the fork point if the chain we knew is no longer canonical.
+func (c *Confirmer) syncHeadersLocked(ctx context.Context, head uint64) error {
+	start := c.tip + 1
+	if c.tip > 0 {
+		// Same-height reorgs only show up by re-checking the tip.
+		fork, err := c.findForkLocked(ctx, c.tip)
+		if err != nil {
+			return err
+		}
+		if fork < c.tip {
+			if err := c.rollbackLocked(ctx, fork, head); err != nil {
+				return err
+			}
+			start = fork + 1
+		}
+	}
+	if head >= c.Retention && start < head-c.Retention+1 {
+		start = head - c.Retention + 1
+	}
+
+	for n := start; n <= head; n++ {
+		header, err := c.source.HeaderByNumber(ctx, new(big.Int).SetUint64(n))
+		if err != nil {
+			return err
+		}
+		if parent, ok := c.headers[n-1]; ok && header.ParentHash != parent {
+			fork, err := c.findForkLocked(ctx, n-1)
+			if err != nil {
+				return err
+			}
+			if err := c.rollbackLocked(ctx, fork, head); err != nil {
+				return err
+			}
+			n = fork
+			continue
+		}
+		c.headers[n] = header.Hash()
+		c.tip = n
+	}
+	return nil
+}
+
+// findForkLocked walks back from n and returns the highest block whose
+// stored hash is still canonical.
+func (c *Confirmer) findForkLocked(ctx context.Context, n uint64) (uint64, error) {
+	for ; n > 0; n-- {
+		stored, ok := c.headers[n]
+		if !ok {
+			return n, nil
+		}
+		header, err := c.source.HeaderByNumber(ctx, new(big.Int).SetUint64(n))
+		if err != nil {
+			return 0, err
+		}
+		if header.Hash() == stored {
+			return n, nil
+		}
+	}
+	return 0, nil
+}
+
+// rollbackLocked forgets everything above fork, reverts released logs in
+// reverse order and refetches the logs of the new branch.
+func (c *Confirmer) rollbackLocked(ctx context.Context, fork, head uint64) error {
+	log.Println("Chain reorg detected, rolling back to block", fork)
+
+	for b := c.tip; b > fork; b-- {
+		delete(c.headers, b)
+		for _, l := range c.pending[b] {
+			delete(c.known, keyOf(l))
+		}
+		delete(c.pending, b)
+
+		logs := c.applied[b]
+		for i := len(logs) - 1; i >= 0; i-- {
+			c.revertLocked(logs[i])
+		}
+		delete(c.applied, b)
+	}
+	c.tip = fork
+	if c.released > fork {
+		c.released = fork
+	}
+	if head <= fork {
+		return nil
+	}
+
+	logs, err := c.source.FilterLogs(ctx, ethereum.FilterQuery{
+		Addresses: c.addresses,
+		FromBlock: new(big.Int).SetUint64(fork + 1),
+		ToBlock:   new(big.Int).SetUint64(head),
+	})
+	if err != nil {
+		return err
+	}
+	for _, l := range logs {
+		key := keyOf(l)
+		if !c.known[key] {
+			c.known[key] = true
+			c.pending[l.BlockNumber] = append(c.pending[l.BlockNumber], l)
+		}
+	}
+	return nil
+}
+
+func (c *Confirmer) removeLocked(block uint64, key blockLogKey) {
+	delete(c.known, key)
+	c.late = without(c.late, key)
+	if logs, ok := c.pending[block]; ok {
+		c.pending[block] = without(logs, key)
+		return
+	}
+	logs := c.applied[block]
+	for i := len(logs) - 1; i >= 0; i-- {
+		if keyOf(logs[i]) == key {
+			c.revertLocked(logs[i])
+			c.applied[block] = append(logs[:i:i], logs[i+1:]...)
+			return
+		}
+	}
+}
+
+// applyLocked hands l on and remembers it for rollback if the handler
+// succeeds.
+func (c *Confirmer) applyLocked(l types.Log) error {
+	if err := c.handle(l); err != nil {
+		return err
+	}
+	c.applied[l.BlockNumber] = append(c.applied[l.BlockNumber], l)
+	return nil
+}
+
+func (c *Confirmer) revertLocked(l types.Log) {
+	delete(c.known, keyOf(l))
+	l.Removed = true
+	if err := c.handle(l); err != nil {
+		log.Println("Event rollback error:", err)
+	}
+}
+
+func (c *Confirmer) pruneLocked() {
+	if c.released <= c.Retention {
+		return
+	}
+	floor := c.released - c.Retention
+	for b, logs := range c.applied {
+		if b <= floor {
+			for _, l := range logs {
+				delete(c.known, keyOf(l))
+			}
+			delete(c.applied, b)
+		}
+	}
+	for b := range c.headers {
+		if b <= floor {
+			delete(c.headers, b)
+		}
+	}
+}
+
+func without(logs []types.Log, key blockLogKey) []types.Log {
+	out := logs[:0]
+	for _, l := range logs {
+		if keyOf(l) != key {
+			out = append(out, l)
+		}
+	}
+	return out
+}
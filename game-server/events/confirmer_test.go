@@ -0,0 +1,263 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var testContract = common.HexToAddress("0x1000000000000000000000000000000000000001")
+
+// testChain is an in-memory Source whose blocks can be reorged.
+type testChain struct {
+	mu      sync.Mutex
+	headers []*types.Header
+	logs    map[common.Hash][]types.Log
+}
+
+func newTestChain(blocks int) *testChain {
+	c := &testChain{logs: make(map[common.Hash][]types.Log)}
+	c.extend(blocks+1, 0)
+	return c
+}
+
+// extend appends n blocks; salt tells apart blocks of different branches.
+func (c *testChain) extend(n int, salt byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := 0; i < n; i++ {
+		h := &types.Header{Number: big.NewInt(int64(len(c.headers))), Extra: []byte{salt}}
+		if len(c.headers) > 0 {
+			h.ParentHash = c.headers[len(c.headers)-1].Hash()
+		}
+		c.headers = append(c.headers, h)
+	}
+}
+
+// reorg replaces every block above fork with n new ones.
+func (c *testChain) reorg(fork uint64, n int, salt byte) {
+	c.mu.Lock()
+	c.headers = c.headers[:fork+1]
+	c.mu.Unlock()
+	c.extend(n, salt)
+}
+
+func (c *testChain) addLog(block uint64, tx byte) types.Log {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	hash := c.headers[block].Hash()
+	l := types.Log{Address: testContract, BlockNumber: block, BlockHash: hash, TxHash: common.Hash{tx}}
+	c.logs[hash] = append(c.logs[hash], l)
+	return l
+}
+
+func (c *testChain) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if number == nil {
+		return c.headers[len(c.headers)-1], nil
+	}
+	if number.Uint64() >= uint64(len(c.headers)) {
+		return nil, ethereum.NotFound
+	}
+	return c.headers[number.Uint64()], nil
+}
+
+func (c *testChain) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []types.Log
+	for n := q.FromBlock.Uint64(); n <= q.ToBlock.Uint64() && n < uint64(len(c.headers)); n++ {
+		out = append(out, c.logs[c.headers[n].Hash()]...)
+	}
+	return out, nil
+}
+
+func (c *testChain) SubscribeFilterLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	return nil, rpc.ErrNotificationsUnsupported
+}
+
+// recorder collects what a Confirmer hands on.
+type recorder struct {
+	logs []types.Log
+}
+
+func (r *recorder) handle(l types.Log) error {
+	r.logs = append(r.logs, l)
+	return nil
+}
+
+func TestConfirmerWaitsForLaggingWatcher(t *testing.T) {
+	ctx := context.Background()
+	chain := newTestChain(1500)
+	win := chain.addLog(1100, 1)
+
+	var rec recorder
+	confirmer := NewConfirmer(chain, []common.Address{testContract}, 3, 1000, rec.handle)
+	watcher := NewWatcher(chain, []common.Address{testContract}, 1000, confirmer.Add)
+	confirmer.Fetched = watcher.Cursor
+
+	// The confirmer runs before the watcher has backfilled anything.
+	if err := confirmer.Advance(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := confirmer.Released(); got != 1000 {
+		t.Fatalf("released %d before the watcher fetched anything, want 1000", got)
+	}
+
+	if err := watcher.Backfill(ctx, 1500); err != nil {
+		t.Fatal(err)
+	}
+	if err := confirmer.Advance(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := confirmer.Released(); got != 1498 {
+		t.Fatalf("released %d, want 1498", got)
+	}
+	if len(rec.logs) != 1 || rec.logs[0].TxHash != win.TxHash {
+		t.Fatalf("handled %v, want the Win in block 1100", rec.logs)
+	}
+}
+
+func TestConfirmerAppliesLateLogs(t *testing.T) {
+	ctx := context.Background()
+	chain := newTestChain(1500)
+
+	var rec recorder
+	confirmer := NewConfirmer(chain, []common.Address{testContract}, 3, 1000, rec.handle)
+	if err := confirmer.Advance(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Far below the retention window: still applied, since it is canonical.
+	late := chain.addLog(1100, 1)
+	if err := confirmer.Add(late); err != nil {
+		t.Fatal(err)
+	}
+	// From a block that is no longer canonical: dropped.
+	stale := late
+	stale.TxHash, stale.BlockHash = common.Hash{2}, common.Hash{0xff}
+	if err := confirmer.Add(stale); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.logs) != 0 {
+		t.Fatal("late log applied before Advance")
+	}
+	if err := confirmer.Advance(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.logs) != 1 || rec.logs[0].TxHash != late.TxHash {
+		t.Fatalf("handled %v, want only the canonical late log", rec.logs)
+	}
+}
+
+func TestConfirmerRollsBackReorgs(t *testing.T) {
+	ctx := context.Background()
+	chain := newTestChain(10)
+	old := chain.addLog(8, 1)
+
+	var rec recorder
+	confirmer := NewConfirmer(chain, []common.Address{testContract}, 2, 5, rec.handle)
+	if err := confirmer.Add(old); err != nil {
+		t.Fatal(err)
+	}
+	if err := confirmer.Advance(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if confirmer.Released() != 9 || len(rec.logs) != 1 {
+		t.Fatalf("released %d with %d logs, want 9 with 1", confirmer.Released(), len(rec.logs))
+	}
+
+	// Blocks 8 and up are replaced; the new branch has another log in 9.
+	chain.reorg(7, 4, 1)
+	replacement := chain.addLog(9, 2)
+	if err := confirmer.Advance(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rec.logs) != 3 {
+		t.Fatalf("handled %d logs, want apply, rollback, apply", len(rec.logs))
+	}
+	if got := rec.logs[1]; !got.Removed || got.TxHash != old.TxHash {
+		t.Errorf("second log = %+v, want the old log removed", got)
+	}
+	if got := rec.logs[2]; got.Removed || got.BlockHash != replacement.BlockHash {
+		t.Errorf("third log = %+v, want the replacement", got)
+	}
+	if got := confirmer.Released(); got != 10 {
+		t.Errorf("released %d, want 10", got)
+	}
+}
+
+func TestConfirmerHoldsUnconfirmedLogs(t *testing.T) {
+	ctx := context.Background()
+	chain := newTestChain(10)
+	l := chain.addLog(10, 1)
+
+	var rec recorder
+	confirmer := NewConfirmer(chain, []common.Address{testContract}, 3, 9, rec.handle)
+	if err := confirmer.Add(l); err != nil {
+		t.Fatal(err)
+	}
+	if err := confirmer.Advance(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.logs) != 0 {
+		t.Fatal("log released with one confirmation")
+	}
+
+	chain.extend(2, 0)
+	if err := confirmer.Advance(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.logs) != 1 {
+		t.Fatal("log not released with three confirmations")
+	}
+}
+
+func TestConfirmerRetriesFailedLog(t *testing.T) {
+	ctx := context.Background()
+	chain := newTestChain(10)
+	first := chain.addLog(6, 1)
+	second := chain.addLog(6, 2)
+	second.Index = 1
+
+	// The second log fails once.
+	var rec recorder
+	calls := 0
+	confirmer := NewConfirmer(chain, []common.Address{testContract}, 2, 5, func(l types.Log) error {
+		if calls++; calls == 2 {
+			return errors.New("handler failed")
+		}
+		return rec.handle(l)
+	})
+	for _, l := range []types.Log{first, second} {
+		if err := confirmer.Add(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := confirmer.Advance(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := confirmer.Released(); got != 5 {
+		t.Fatalf("released %d past a failed log in block 6, want 5", got)
+	}
+
+	if err := confirmer.Advance(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := confirmer.Released(); got != 9 {
+		t.Fatalf("released %d, want 9", got)
+	}
+	if len(rec.logs) != 2 || rec.logs[0].TxHash != first.TxHash || rec.logs[1].TxHash != second.TxHash {
+		t.Fatalf("handled %v, want both logs of block 6 once, in order", rec.logs)
+	}
+}
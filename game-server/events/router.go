@@ -0,0 +1,151 @@
+// Package events routes contract logs to typed handlers, using the topic IDs
+// from the generated bindings' ABI rather than hand-written signatures.
+package events
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+type route struct {
+	contract common.Address
+	topic    common.Hash
+	removed  bool
+}
+
+type contract struct {
+	name string
+	abi  *abi.ABI
+}
+
+// Router dispatches logs to the handlers registered for their contract and
+// event. Logs with Removed set go to the handlers registered with OnRemoved
+// instead. Registration happens at startup; Dispatch is safe to call from
+// several goroutines once it is done.
+type Router struct {
+	mu        sync.RWMutex
+	contracts map[common.Address]contract
+	handlers  map[route][]func(types.Log) error
+	names     map[route]string
+}
+
+// NewRouter returns an empty Router.
+func NewRouter() *Router {
+	return &Router{
+		contracts: make(map[common.Address]contract),
+		handlers:  make(map[route][]func(types.Log) error),
+		names:     make(map[route]string),
+	}
+}
+
+// AddContract makes the events of the contract at addr available for
+// registration. name is only used in error messages.
+func (r *Router) AddContract(name string, addr common.Address, meta *bind.MetaData) error {
+	parsed, err := meta.GetAbi()
+	if err != nil {
+		return fmt.Errorf("%s ABI: %w", name, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.contracts[addr] = contract{name: name, abi: parsed}
+	return nil
+}
+
+// Addresses returns every contract known to the router, for use in a log
+// filter query.
+func (r *Router) Addresses() []common.Address {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]common.Address, 0, len(r.contracts))
+	for addr := range r.contracts {
+		out = append(out, addr)
+	}
+	return out
+}
+
+// Topic returns the topic ID of a registered contract's event.
+func (r *Router) Topic(addr common.Address, event string) (common.Hash, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.contracts[addr]
+	if !ok {
+		return common.Hash{}, fmt.Errorf("unknown contract %s", addr.Hex())
+	}
+	ev, ok := c.abi.Events[event]
+	if !ok {
+		return common.Hash{}, fmt.Errorf("%s ABI has no event %q", c.name, event)
+	}
+	return ev.ID, nil
+}
+
+// On registers handle for event on the contract at addr. parse is the
+// binding's Parse<Event> method. It fails if the event is not in the
+// contract's ABI, so a typo stops the server at startup instead of silently
+// never firing.
+func On[T any](r *Router, addr common.Address, event string, parse func(types.Log) (*T, error), handle func(*T) error) error {
+	return register(r, addr, event, false, parse, handle)
+}
+
+// OnRemoved registers handle for logs of event that were dropped by a chain
+// reorg after being dispatched, so it can undo what the On handler did.
+func OnRemoved[T any](r *Router, addr common.Address, event string, parse func(types.Log) (*T, error), handle func(*T) error) error {
+	return register(r, addr, event, true, parse, handle)
+}
+
+func register[T any](r *Router, addr common.Address, event string, removed bool, parse func(types.Log) (*T, error), handle func(*T) error) error {
+	topic, err := r.Topic(addr, event)
+	if err != nil {
+		return err
+	}
+	key := route{contract: addr, topic: topic, removed: removed}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.names[key] = r.contracts[addr].name + "." + event
+	r.handlers[key] = append(r.handlers[key], func(l types.Log) error {
+		ev, err := parse(l)
+		if err != nil {
+			return fmt.Errorf("decode %s: %w", r.names[key], err)
+		}
+		return handle(ev)
+	})
+	return nil
+}
+
+// Dispatch decodes l and runs its handlers in registration order. Logs with
+// no registered handler are ignored. The first handler error is returned
+// after all handlers have run.
+func (r *Router) Dispatch(l types.Log) error {
+	if len(l.Topics) == 0 {
+		return nil
+	}
+	key := route{contract: l.Address, topic: l.Topics[0], removed: l.Removed}
+
+	r.mu.RLock()
+	handlers := r.handlers[key]
+	name := r.names[key]
+	r.mu.RUnlock()
+
+	var first error
+	for _, h := range handlers {
+		if err := h(l); err != nil && first == nil {
+			first = fmt.Errorf("%s in tx %s: %w", name, l.TxHash.Hex(), err)
+		}
+	}
+	return first
+}
+
+// Name returns the "Contract.Event" name of l, or "" if nothing handles it.
+func (r *Router) Name(l types.Log) string {
+	if len(l.Topics) == 0 {
+		return ""
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.names[route{contract: l.Address, topic: l.Topics[0]}]
+}
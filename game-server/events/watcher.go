@@ -0,0 +1,306 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Source is the part of ethclient.Client the watcher needs.
+type Source interface {
+	ethereum.LogFilterer
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+}
+
+// HandleFunc processes one log. A log whose handler returns an error is
+// handed over again on the next pass, so handlers must tolerate seeing a log
+// twice; the cursor does not move past it until it succeeds.
+type HandleFunc func(types.Log) error
+
+type logKey struct {
+	tx    common.Hash
+	index uint
+}
+
+// Watcher follows logs from a set of contracts over a subscription. When
+// the subscription dies it resubscribes with exponential backoff and
+// backfills everything after the last fully processed block with
+// FilterLogs, so each log is handled exactly once. On nodes without
+// subscription support (plain HTTP) it tails the chain by polling instead.
+type Watcher struct {
+	source    Source
+	addresses []common.Address
+	handle    HandleFunc
+
+	// ChunkSize bounds the block range of a single FilterLogs call.
+	ChunkSize  uint64
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// PollInterval is how often the head is checked when polling.
+	PollInterval time.Duration
+
+	mu     sync.Mutex
+	cursor uint64
+	seen   map[logKey]uint64
+	// failed is the lowest block with a log whose handler failed, or 0.
+	// The cursor stays below it so the next Backfill fetches it again.
+	failed uint64
+}
+
+// NewWatcher returns a watcher that resumes after block cursor. A zero
+// cursor starts from the current head without backfilling.
+func NewWatcher(source Source, addresses []common.Address, cursor uint64, handle HandleFunc) *Watcher {
+	return &Watcher{
+		source:       source,
+		addresses:    addresses,
+		handle:       handle,
+		ChunkSize:    2000,
+		MinBackoff:   time.Second,
+		MaxBackoff:   time.Minute,
+		PollInterval: 12 * time.Second,
+		cursor:       cursor,
+		seen:         make(map[logKey]uint64),
+	}
+}
+
+// Cursor returns the last block whose logs have all been handled.
+func (w *Watcher) Cursor() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.cursor
+}
+
+// Run follows the chain until ctx is cancelled, switching to Poll if the
+// node cannot do subscriptions.
+func (w *Watcher) Run(ctx context.Context) error {
+	if err := w.initCursor(ctx); err != nil {
+		return err
+	}
+
+	backoff := w.MinBackoff
+	for {
+		err := w.follow(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, rpc.ErrNotificationsUnsupported) {
+			log.Println("Node does not support subscriptions, polling every", w.PollInterval)
+			return w.Poll(ctx)
+		}
+		log.Println("Event subscription lost:", err, "- retrying in", backoff)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if err == nil {
+			backoff = w.MinBackoff
+		} else if backoff *= 2; backoff > w.MaxBackoff {
+			backoff = w.MaxBackoff
+		}
+	}
+}
+
+// follow subscribes, backfills the gap and then handles live logs until the
+// subscription fails. Subscribing before backfilling means nothing emitted
+// in between is lost; duplicates are dropped by markSeen. A subscription
+// says nothing about blocks without logs, so every PollInterval the cursor
+// is also caught up to the head with FilterLogs.
+func (w *Watcher) follow(ctx context.Context) error {
+	logs := make(chan types.Log, 64)
+	sub, err := w.source.SubscribeFilterLogs(ctx, ethereum.FilterQuery{Addresses: w.addresses}, logs)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	head, err := w.head(ctx)
+	if err != nil {
+		return err
+	}
+	if err := w.Backfill(ctx, head); err != nil {
+		return err
+	}
+	log.Println("Listening for contract events from block", w.Cursor()+1)
+
+	ticker := time.NewTicker(w.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-sub.Err():
+			return err
+		case l := <-logs:
+			w.process(l)
+		case <-ticker.C:
+			head, err := w.head(ctx)
+			if err == nil {
+				err = w.Backfill(ctx, head)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Poll tails the chain by asking for the head every PollInterval and
+// pulling the new logs in ChunkSize ranges. Errors are logged and retried on
+// the next tick.
+func (w *Watcher) Poll(ctx context.Context) error {
+	if err := w.initCursor(ctx); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(w.PollInterval)
+	defer ticker.Stop()
+	for {
+		head, err := w.head(ctx)
+		if err == nil {
+			err = w.Backfill(ctx, head)
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Println("Log polling failed:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Backfill handles every log after the cursor up to and including block to.
+// It stops early, leaving the cursor before the block, when a handler fails;
+// the next call starts there again.
+func (w *Watcher) Backfill(ctx context.Context, to uint64) error {
+	w.mu.Lock()
+	w.failed = 0
+	w.mu.Unlock()
+
+	for from := w.Cursor() + 1; from <= to; {
+		end := from + w.ChunkSize - 1
+		if end > to {
+			end = to
+		}
+		logs, err := w.source.FilterLogs(ctx, ethereum.FilterQuery{
+			Addresses: w.addresses,
+			FromBlock: new(big.Int).SetUint64(from),
+			ToBlock:   new(big.Int).SetUint64(end),
+		})
+		if err != nil {
+			return err
+		}
+		for _, l := range logs {
+			if !w.process(l) {
+				return nil
+			}
+		}
+		w.setCursor(end)
+		from = end + 1
+	}
+	return nil
+}
+
+func (w *Watcher) initCursor(ctx context.Context) error {
+	if w.Cursor() != 0 {
+		return nil
+	}
+	head, err := w.head(ctx)
+	if err != nil {
+		return err
+	}
+	w.setCursor(head)
+	return nil
+}
+
+func (w *Watcher) head(ctx context.Context) (uint64, error) {
+	header, err := w.source.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	return header.Number.Uint64(), nil
+}
+
+// process hands l to the handler and reports whether it succeeded.
+func (w *Watcher) process(l types.Log) bool {
+	key := logKey{tx: l.TxHash, index: l.Index}
+	if l.Removed {
+		// Passed on so a later stage can roll back; a re-inclusion of the
+		// same log must not be mistaken for a duplicate. A removed log
+		// cannot be fetched again, so a failure is only logged.
+		w.mu.Lock()
+		delete(w.seen, key)
+		w.mu.Unlock()
+		if err := w.handle(l); err != nil {
+			log.Println("Event handler error:", err)
+		}
+		return true
+	}
+	if !w.markSeen(l) {
+		return true
+	}
+	if err := w.handle(l); err != nil {
+		log.Println("Event handler error:", err, "- retrying block", l.BlockNumber)
+		w.mu.Lock()
+		delete(w.seen, key)
+		if w.failed == 0 || l.BlockNumber < w.failed {
+			w.failed = l.BlockNumber
+		}
+		w.mu.Unlock()
+		return false
+	}
+	return true
+}
+
+// markSeen records l and reports whether it is new. Logs arrive in block
+// order, so a log in block N means every block before N is complete.
+func (w *Watcher) markSeen(l types.Log) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if l.BlockNumber <= w.cursor {
+		return false
+	}
+	key := logKey{tx: l.TxHash, index: l.Index}
+	if _, ok := w.seen[key]; ok {
+		return false
+	}
+	w.seen[key] = l.BlockNumber
+	if l.BlockNumber > 0 {
+		w.advanceLocked(l.BlockNumber - 1)
+	}
+	return true
+}
+
+func (w *Watcher) setCursor(block uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.advanceLocked(block)
+}
+
+func (w *Watcher) advanceLocked(block uint64) {
+	if w.failed != 0 && block >= w.failed {
+		block = w.failed - 1
+	}
+	if block <= w.cursor {
+		return
+	}
+	w.cursor = block
+	for key, n := range w.seen {
+		if n <= block {
+			delete(w.seen, key)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestWatcherRetriesFailedLog(t *testing.T) {
+	ctx := context.Background()
+	chain := newTestChain(20)
+	first := chain.addLog(12, 1)
+	second := chain.addLog(12, 2)
+	chain.addLog(15, 3)
+
+	// The second log of block 12 fails once.
+	rec := &recorder{}
+	calls := 0
+	watcher := NewWatcher(chain, []common.Address{testContract}, 10, func(l types.Log) error {
+		if calls++; calls == 2 {
+			return errors.New("handler failed")
+		}
+		return rec.handle(l)
+	})
+
+	if err := watcher.Backfill(ctx, 20); err != nil {
+		t.Fatal(err)
+	}
+	if got := watcher.Cursor(); got != 11 {
+		t.Fatalf("cursor %d after a failed log in block 12, want 11", got)
+	}
+	if len(rec.logs) != 1 || rec.logs[0].TxHash != first.TxHash {
+		t.Fatalf("handled %v, want only the first log", rec.logs)
+	}
+
+	if err := watcher.Backfill(ctx, 20); err != nil {
+		t.Fatal(err)
+	}
+	if got := watcher.Cursor(); got != 20 {
+		t.Fatalf("cursor %d, want 20", got)
+	}
+	if len(rec.logs) != 3 || rec.logs[1].TxHash != second.TxHash {
+		t.Fatalf("handled %v, want the failed log once more and nothing twice", rec.logs)
+	}
+}
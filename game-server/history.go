@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/exccrr/solidity-token-go-integration/game-server/store"
+)
+
+// GameLog is one play as shown by /history.
+type GameLog = store.Play
+
+// outcome is what the Game events tell us about one play transaction.
+type outcome struct {
+	winning     int
+	result      string
+	prize       *big.Int
+	blockNumber uint64
+	blockTime   time.Time
+	// parked is when the outcome started waiting for its entry.
+	parked time.Time
+}
+
+// Parked outcomes are kept for pendingTTL, and at most pendingMax of them.
+// Plays sent by someone else never get an entry, so they must not pile up,
+// but an entry is added well within the TTL of its events.
+const (
+	pendingMax = 1024
+	pendingTTL = time.Hour
+)
+
+// gameHistory records the plays submitted by this server in the store and
+// fills in their outcome as the Game events arrive. Events can beat the
+// handler that recorded the play, so outcomes for unknown transactions are
+// parked in memory until the matching entry is added, for up to pendingTTL.
+type gameHistory struct {
+	mu      sync.Mutex
+	store   store.Store
+	pending map[common.Hash]*outcome
+}
+
+func newGameHistory(s store.Store) *gameHistory {
+	return &gameHistory{
+		store:   s,
+		pending: make(map[common.Hash]*outcome),
+	}
+}
+
+// Add records a submitted play.
+func (h *gameHistory) Add(entry GameLog) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.store.AddPlay(entry); err != nil {
+		log.Println("Failed to store play:", err)
+		return
+	}
+	hash := common.HexToHash(entry.TxHash)
+	if o, ok := h.pending[hash]; ok {
+		delete(h.pending, hash)
+		h.applyLocked(hash, o)
+	}
+}
+
+// Rekey moves an entry to the hash of the replacement transaction that was
+// actually mined.
+func (h *gameHistory) Rekey(from, to common.Hash) {
+	if from == to {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.store.RekeyPlay(from, to); err != nil {
+		log.Println("Failed to rekey play:", err)
+		return
+	}
+	if o, ok := h.pending[to]; ok {
+		delete(h.pending, to)
+		h.applyLocked(to, o)
+	}
+}
+
+// ResolveBet applies a BetPlaced event.
+func (h *gameHistory) ResolveBet(tx common.Hash, winning uint8, blockNumber uint64, blockTime time.Time) {
+	h.update(tx, func(o *outcome) {
+		o.winning = int(winning)
+		o.blockNumber = blockNumber
+		o.blockTime = blockTime
+	})
+}
+
+// ResolveWin applies a Win event.
+func (h *gameHistory) ResolveWin(tx common.Hash, prize *big.Int) {
+	h.update(tx, func(o *outcome) {
+		o.result = "win"
+		o.prize = prize
+	})
+}
+
+// ResolveLoss applies a Loss event.
+func (h *gameHistory) ResolveLoss(tx common.Hash) {
+	h.update(tx, func(o *outcome) {
+		o.result = "loss"
+		o.prize = new(big.Int)
+	})
+}
+
+// Unresolve clears the outcome of a play whose events were reorged out.
+func (h *gameHistory) Unresolve(tx common.Hash) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.pending, tx)
+	err := h.store.UpdatePlay(tx, func(entry *GameLog) {
+		entry.Winning = -1
+		entry.Result = "submitted"
+		entry.Prize = ""
+		entry.BlockNumber = 0
+		entry.BlockTime = time.Time{}
+	})
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Println("Failed to unresolve play:", err)
+	}
+}
+
+// List returns all entries in submission order.
+func (h *gameHistory) List() ([]GameLog, error) {
+	return h.store.Plays()
+}
+
+func (h *gameHistory) update(tx common.Hash, fn func(*outcome)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	o, ok := h.pending[tx]
+	if !ok {
+		o = &outcome{winning: -1, parked: time.Now()}
+	}
+	fn(o)
+	if h.applyLocked(tx, o) {
+		delete(h.pending, tx)
+		return
+	}
+	if !ok {
+		h.evictLocked(o.parked)
+	}
+	h.pending[tx] = o
+}
+
+// evictLocked makes room for one more parked outcome: it drops the expired
+// ones and, if that is not enough, the oldest.
+func (h *gameHistory) evictLocked(now time.Time) {
+	if len(h.pending) < pendingMax {
+		return
+	}
+	var oldest common.Hash
+	for tx, o := range h.pending {
+		if now.Sub(o.parked) > pendingTTL {
+			delete(h.pending, tx)
+		} else if oldest == (common.Hash{}) || o.parked.Before(h.pending[oldest].parked) {
+			oldest = tx
+		}
+	}
+	if len(h.pending) >= pendingMax {
+		delete(h.pending, oldest)
+	}
+}
+
+// applyLocked merges o into the stored entry and reports whether there was
+// one.
+func (h *gameHistory) applyLocked(tx common.Hash, o *outcome) bool {
+	err := h.store.UpdatePlay(tx, func(entry *GameLog) {
+		if o.winning >= 0 {
+			entry.Winning = o.winning
+		}
+		if o.result != "" {
+			entry.Result = o.result
+		}
+		if o.prize != nil {
+			entry.Prize = o.prize.String()
+		}
+		if o.blockNumber != 0 {
+			entry.BlockNumber = o.blockNumber
+			entry.BlockTime = o.blockTime
+		}
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		return false
+	}
+	if err != nil {
+		log.Println("Failed to update play:", err)
+	}
+	return true
+}
+
+var (
+	blockTimesMu sync.Mutex
+	blockTimes   = map[uint64]time.Time{}
+)
+
+// blockTime returns the timestamp of a block, or the zero time if the node
+// cannot tell us.
+func blockTime(number uint64) time.Time {
+	blockTimesMu.Lock()
+	t, ok := blockTimes[number]
+	blockTimesMu.Unlock()
+	if ok {
+		return t
+	}
+
+	header, err := client.HeaderByNumber(context.Background(), new(big.Int).SetUint64(number))
+	if err != nil {
+		log.Println("Block header lookup failed:", err)
+		return time.Time{}
+	}
+	t = time.Unix(int64(header.Time), 0).UTC()
+
+	blockTimesMu.Lock()
+	if len(blockTimes) > 1024 {
+		blockTimes = map[uint64]time.Time{}
+	}
+	blockTimes[number] = t
+	blockTimesMu.Unlock()
+	return t
+}
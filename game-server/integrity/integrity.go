@@ -0,0 +1,165 @@
+// Package integrity checks at startup that the configured contracts are the
+// ones the server was built for and are wired to each other and to the
+// server key the way the write paths expect.
+package integrity
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/exccrr/solidity-token-go-integration/game-server/game"
+	"github.com/exccrr/solidity-token-go-integration/game-server/token"
+)
+
+// Check outcomes.
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+	StatusSkip = "skip"
+)
+
+// Severity says what a failed check means for the server.
+type Severity string
+
+const (
+	// Critical failures mean the server is talking to the wrong contracts.
+	Critical Severity = "critical"
+	// Write failures mean reads work but some transactions will revert.
+	Write Severity = "write"
+	// Info failures only affect features the server does not use yet.
+	Info Severity = "info"
+)
+
+// Check is one line of the report.
+type Check struct {
+	Name     string   `json:"name"`
+	Status   string   `json:"status"`
+	Severity Severity `json:"severity"`
+	Expected string   `json:"expected,omitempty"`
+	Actual   string   `json:"actual,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// Report is the result of Verify.
+type Report struct {
+	Game   common.Address `json:"game"`
+	Token  common.Address `json:"token"`
+	Signer common.Address `json:"signer"`
+	Checks []Check        `json:"checks"`
+}
+
+// Failed reports whether any check of the given severity failed.
+func (r *Report) Failed(sev Severity) bool {
+	for _, c := range r.Checks {
+		if c.Status == StatusFail && c.Severity == sev {
+			return true
+		}
+	}
+	return false
+}
+
+// String renders the report one check per line for the startup log.
+func (r *Report) String() string {
+	var b strings.Builder
+	for _, c := range r.Checks {
+		fmt.Fprintf(&b, "  [%s] %-15s %s", c.Status, c.Name, c.Severity)
+		if c.Status == StatusFail && c.Expected != "" {
+			fmt.Fprintf(&b, " expected=%s actual=%s", c.Expected, c.Actual)
+		}
+		if c.Detail != "" {
+			fmt.Fprintf(&b, " (%s)", c.Detail)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Verify runs every check. tokenBin is the creation bytecode from
+// build/Token.bin; pass nil to skip the bytecode comparison. Errors talking
+// to the node are reported as failed checks rather than returned.
+func Verify(ctx context.Context, backend bind.ContractBackend, gameAddr, tokenAddr, signer common.Address, tokenBin []byte) *Report {
+	r := &Report{Game: gameAddr, Token: tokenAddr, Signer: signer}
+	opts := &bind.CallOpts{Context: ctx}
+
+	r.Checks = append(r.Checks, checkTokenCode(ctx, backend, tokenAddr, tokenBin))
+
+	gameCaller, err := game.NewGameCaller(gameAddr, backend)
+	if err != nil {
+		r.Checks = append(r.Checks, failed("game_token", Critical, err))
+		return r
+	}
+	tokenCaller, err := token.NewTokenCaller(tokenAddr, backend)
+	if err != nil {
+		r.Checks = append(r.Checks, failed("token_owner", Write, err))
+		return r
+	}
+
+	if got, err := gameCaller.Token(opts); err != nil {
+		r.Checks = append(r.Checks, failed("game_token", Critical, err))
+	} else {
+		r.Checks = append(r.Checks, compare("game_token", Critical, tokenAddr, got, "Game.token() must be the configured Token"))
+	}
+
+	if got, err := tokenCaller.Owner(opts); err != nil {
+		r.Checks = append(r.Checks, failed("token_owner", Write, err))
+	} else {
+		r.Checks = append(r.Checks, compare("token_owner", Write, signer, got, "server key must own Token to mint and pay bonuses"))
+	}
+
+	if got, err := gameCaller.Owner(opts); err != nil {
+		r.Checks = append(r.Checks, failed("game_owner", Info, err))
+	} else {
+		r.Checks = append(r.Checks, compare("game_owner", Info, signer, got, "only Game.owner() can withdraw the house balance"))
+	}
+	return r
+}
+
+// checkTokenCode compares the deployed runtime code with the build output.
+// The runtime code is embedded verbatim in the creation code, metadata hash
+// included, so any other compilation or contract fails the check.
+func checkTokenCode(ctx context.Context, backend bind.ContractBackend, addr common.Address, creation []byte) Check {
+	c := Check{Name: "token_bytecode", Severity: Critical}
+	if len(creation) == 0 {
+		c.Status = StatusSkip
+		c.Detail = "no build/Token.bin to compare against"
+		return c
+	}
+	code, err := backend.CodeAt(ctx, addr, nil)
+	if err != nil {
+		return failed(c.Name, c.Severity, err)
+	}
+	if len(code) == 0 {
+		c.Status = StatusFail
+		c.Expected = "Token runtime code"
+		c.Actual = "no code"
+		return c
+	}
+	if !bytes.Contains(creation, code) {
+		c.Status = StatusFail
+		c.Expected = "runtime code from build/Token.bin"
+		c.Actual = fmt.Sprintf("%d bytes, hash prefix %s", len(code), hexutil.Encode(code[:min(len(code), 8)]))
+		c.Detail = "deployed Token was not built from this source"
+		return c
+	}
+	c.Status = StatusOK
+	return c
+}
+
+func compare(name string, sev Severity, want, got common.Address, detail string) Check {
+	c := Check{Name: name, Severity: sev, Status: StatusOK, Expected: want.Hex(), Actual: got.Hex()}
+	if want != got {
+		c.Status = StatusFail
+		c.Detail = detail
+	}
+	return c
+}
+
+func failed(name string, sev Severity, err error) Check {
+	return Check{Name: name, Severity: sev, Status: StatusFail, Detail: err.Error()}
+}
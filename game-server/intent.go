@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+
+	"github.com/exccrr/solidity-token-go-integration/game-server/intents"
+	"github.com/exccrr/solidity-token-go-integration/game-server/store"
+)
+
+var intentVerifier *intents.Verifier
+
+// intentHandler returns the typed data a player signs to ask for a play:
+// their next nonce and a deadline intent_ttl from now.
+func intentHandler(c *gin.Context) {
+	guess, err := strconv.Atoi(c.Query("guess"))
+	if err != nil || guess < 1 || guess > 10 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "guess must be between 1 and 10"})
+		return
+	}
+	player, ok := resolveAddress(c, "address", c.Param("address"))
+	if !ok {
+		return
+	}
+	nonce, err := db.Nonce(player)
+	if err != nil {
+		log.Println("Nonce read failed:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "nonce unavailable"})
+		return
+	}
+	intent := intents.Intent{
+		Player:   player,
+		Guess:    uint8(guess),
+		Nonce:    nonce,
+		Deadline: uint64(time.Now().Add(cfg.IntentTTL).Unix()),
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"player":    player.Hex(),
+		"nonce":     intent.Nonce,
+		"deadline":  intent.Deadline,
+		"typedData": intentVerifier.TypedData(intent),
+	})
+}
+
+// checkIntent verifies the intent in req, signed as player, and consumes
+// its nonce. It writes the error response and returns false if the play
+// must not go ahead.
+func checkIntent(c *gin.Context, player common.Address, req PlayRequest) (common.Address, bool) {
+	intent := intents.Intent{
+		Player:   player,
+		Guess:    uint8(req.Guess),
+		Nonce:    req.Nonce,
+		Deadline: req.Deadline,
+	}
+
+	err := intentVerifier.Verify(intent, req.Signature, time.Now())
+	if err == nil {
+		err = db.UseNonce(intent.Player, intent.Nonce)
+	}
+	switch {
+	case err == nil:
+		return intent.Player, true
+	case errors.Is(err, intents.ErrExpired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "play intent expired", "code": "INTENT_EXPIRED"})
+	case errors.Is(err, intents.ErrBadSignature), errors.Is(err, intents.ErrWrongSigner):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "code": "INTENT_BAD_SIGNATURE"})
+	case errors.Is(err, store.ErrNonceUsed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "INTENT_NONCE_USED"})
+	default:
+		log.Println("Intent check failed:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "intent check failed"})
+	}
+	return common.Address{}, false
+}
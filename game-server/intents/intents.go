@@ -0,0 +1,121 @@
+// Package intents verifies EIP-712 signed play intents, the proof that a
+// player asked for a play the server pays for.
+package intents
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// Domain name and version players sign under.
+const (
+	DomainName    = "MTK Game"
+	DomainVersion = "1"
+)
+
+var (
+	ErrBadSignature = errors.New("malformed play intent signature")
+	ErrWrongSigner  = errors.New("play intent not signed by the player")
+	ErrExpired      = errors.New("play intent expired")
+)
+
+// Types is the EIP-712 type set of a play intent.
+var Types = apitypes.Types{
+	"EIP712Domain": {
+		{Name: "name", Type: "string"},
+		{Name: "version", Type: "string"},
+		{Name: "chainId", Type: "uint256"},
+		{Name: "verifyingContract", Type: "address"},
+	},
+	"PlayIntent": {
+		{Name: "player", Type: "address"},
+		{Name: "guess", Type: "uint8"},
+		{Name: "nonce", Type: "uint256"},
+		{Name: "deadline", Type: "uint256"},
+	},
+}
+
+// Intent is PlayIntent{player, guess, nonce, deadline}. Deadline is a unix
+// time in seconds.
+type Intent struct {
+	Player   common.Address
+	Guess    uint8
+	Nonce    uint64
+	Deadline uint64
+}
+
+// Verifier checks intents for one chain and Game contract.
+type Verifier struct {
+	domain apitypes.TypedDataDomain
+}
+
+// NewVerifier binds intents to chainID and the Game at game, so a
+// signature cannot be replayed against another deployment.
+func NewVerifier(chainID uint64, game common.Address) *Verifier {
+	return &Verifier{domain: apitypes.TypedDataDomain{
+		Name:              DomainName,
+		Version:           DomainVersion,
+		ChainId:           (*math.HexOrDecimal256)(new(big.Int).SetUint64(chainID)),
+		VerifyingContract: game.Hex(),
+	}}
+}
+
+// TypedData returns what the player's wallet signs with
+// eth_signTypedData_v4.
+func (v *Verifier) TypedData(i Intent) apitypes.TypedData {
+	return apitypes.TypedData{
+		Types:       Types,
+		PrimaryType: "PlayIntent",
+		Domain:      v.domain,
+		Message: apitypes.TypedDataMessage{
+			"player":   i.Player.Hex(),
+			"guess":    fmt.Sprint(i.Guess),
+			"nonce":    fmt.Sprint(i.Nonce),
+			"deadline": fmt.Sprint(i.Deadline),
+		},
+	}
+}
+
+// Recover returns the address that signed i. sig is the 65-byte
+// [R || S || V] signature; V may be 0/1 or 27/28.
+func (v *Verifier) Recover(i Intent, sig []byte) (common.Address, error) {
+	if len(sig) != crypto.SignatureLength {
+		return common.Address{}, ErrBadSignature
+	}
+	hash, _, err := apitypes.TypedDataAndHash(v.TypedData(i))
+	if err != nil {
+		return common.Address{}, err
+	}
+	sig = append([]byte(nil), sig...)
+	if sig[64] >= 27 {
+		sig[64] -= 27
+	}
+	pub, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// Verify checks that i is signed by i.Player and has not expired. Nonces
+// are the caller's to enforce.
+func (v *Verifier) Verify(i Intent, sig []byte, now time.Time) error {
+	if uint64(now.Unix()) > i.Deadline {
+		return ErrExpired
+	}
+	signer, err := v.Recover(i, sig)
+	if err != nil {
+		return err
+	}
+	if signer != i.Player {
+		return ErrWrongSigner
+	}
+	return nil
+}
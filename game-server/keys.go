@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/exccrr/solidity-token-go-integration/game-server/signer"
+)
+
+// newSigner opens the operator key as configured by cfg.Signer.
+func newSigner() (signer.Signer, error) {
+	chainID := new(big.Int).SetUint64(cfg.ChainID)
+
+	var (
+		s   signer.Signer
+		err error
+	)
+	switch cfg.Signer {
+	case "keystore":
+		s, err = signer.OpenKeystore(cfg.KeystorePath, cfg.KeystorePasswordFile, chainID)
+	case "clef":
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		s, err = signer.DialClef(ctx, cfg.ClefURL, cfg.SignerAddress, chainID)
+	case "pkcs11":
+		var pin string
+		if pin, err = signer.ReadSecret(cfg.PKCS11PINFile); err != nil {
+			return nil, err
+		}
+		s, err = signer.OpenPKCS11(signer.PKCS11Config{
+			Module:     cfg.PKCS11Module,
+			TokenLabel: cfg.PKCS11Token,
+			KeyLabel:   cfg.PKCS11Key,
+			PIN:        pin,
+		}, chainID)
+	default:
+		s, err = signer.FromHex(os.Getenv("PRIVATE_KEY"), chainID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cfg.SignerAddress != (common.Address{}) && s.Address() != cfg.SignerAddress {
+		return nil, fmt.Errorf("%s signer is %s, signer_address says %s", cfg.Signer, s.Address().Hex(), cfg.SignerAddress.Hex())
+	}
+	return s, nil
+}
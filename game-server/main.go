@@ -2,106 +2,230 @@ package main
 
 import (
 	"context"
-	"crypto/ecdsa"
+	"errors"
+	"flag"
 	"log"
 	"math/big"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
-	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 
+	"github.com/exccrr/solidity-token-go-integration/game-server/amount"
+	"github.com/exccrr/solidity-token-go-integration/game-server/config"
+	"github.com/exccrr/solidity-token-go-integration/game-server/ens"
 	"github.com/exccrr/solidity-token-go-integration/game-server/game"
+	"github.com/exccrr/solidity-token-go-integration/game-server/intents"
+	"github.com/exccrr/solidity-token-go-integration/game-server/payouts"
+	"github.com/exccrr/solidity-token-go-integration/game-server/relay"
+	"github.com/exccrr/solidity-token-go-integration/game-server/reverts"
+	"github.com/exccrr/solidity-token-go-integration/game-server/session"
+	"github.com/exccrr/solidity-token-go-integration/game-server/signer"
+	"github.com/exccrr/solidity-token-go-integration/game-server/siwe"
+	"github.com/exccrr/solidity-token-go-integration/game-server/store"
 	"github.com/exccrr/solidity-token-go-integration/game-server/token"
-)
-
-const (
-	tokenAddress = "0xa33239e13303Fe9586C25b70ABd4D5d65E7B368f"
-	gameAddress  = "0x3726fef83444Ba54F925A5d2195f697234DfA30C"
-	chainID      = 11155111
-)
-
-var (
-	topicGameWin  = crypto.Keccak256Hash([]byte("Win(address,uint8,uint8)")).Hex()
-	topicGameLoss = crypto.Keccak256Hash([]byte("Loss(address,uint8,uint8)")).Hex()
+	"github.com/exccrr/solidity-token-go-integration/game-server/txmgr"
 )
 
 var (
+	cfg           *config.Config
 	client        *ethclient.Client
-	privateKey    *ecdsa.PrivateKey
+	txSigner      signer.Signer
 	publicAddr    string
 	tokenInstance *token.Token
 	gameInstance  *game.Game
-	winStreaks    = map[string]int{}
-	bonusAmount   = new(big.Int).Mul(big.NewInt(50), big.NewInt(1e18))
+	txWaiter      *txmgr.Waiter
+	nonces        *txmgr.NonceManager
+	feePolicy     *txmgr.FeePolicy
+	revertDecoder *reverts.Decoder
+	playMu        sync.Mutex
+	db            store.Store
+	history       *gameHistory
+	payoutEngine  *payouts.Engine
+	winStreaks    map[string]int
+	units         *amount.Unit
 )
 
-type GameLog struct {
-	Address   string    `json:"address"`
-	Guess     int       `json:"guess"`
-	Winning   int       `json:"winning"`
-	Result    string    `json:"result"`
-	TxHash    string    `json:"txHash"`
-	Timestamp time.Time `json:"timestamp"`
-}
-
-var gameLogs []GameLog
-
+// PlayRequest carries a signed PlayIntent: Address signed Guess, Nonce
+// and Deadline as EIP-712 typed data.
 type PlayRequest struct {
-	Address string `json:"address"`
-	Guess   int    `json:"guess"`
+	Address   string        `json:"address"`
+	Guess     int           `json:"guess"`
+	Nonce     uint64        `json:"nonce"`
+	Deadline  uint64        `json:"deadline"`
+	Signature hexutil.Bytes `json:"signature"`
 }
 
 func main() {
 	_ = godotenv.Load()
 
-	infuraURL := os.Getenv("SEPOLIA_URL")
-	priv := os.Getenv("PRIVATE_KEY")
+	runBackfill := flag.Bool("backfill", false, "rebuild history and streaks from the Game contract's events before serving")
+	fromBlock := flag.Uint64("from-block", 0, "first block to backfill from; must not be after deploy_block (default deploy_block)")
 
 	var err error
-	privateKey, err = crypto.HexToECDSA(priv)
+	cfg, err = config.Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+
+	client, err = dialNode()
 	if err != nil {
-		log.Fatal("Invalid private key:", err)
+		log.Fatal("Failed to connect to Ethereum node: ", err)
 	}
 
-	client, err = ethclient.Dial(infuraURL)
+	txSigner, err = newSigner()
 	if err != nil {
-		log.Fatal("Failed to connect to Ethereum node:", err)
+		log.Fatal("Failed to open signer: ", err)
 	}
+	publicAddr = txSigner.Address().Hex()
+	log.Println("Owner address:", publicAddr, "signer:", cfg.Signer)
+
+	nonces = txmgr.NewNonceManager(client, common.HexToAddress(publicAddr))
 
-	publicKey := privateKey.Public()
-	publicAddr = crypto.PubkeyToAddress(*publicKey.(*ecdsa.PublicKey)).Hex()
-	log.Println("Owner address:", publicAddr)
+	db, err = store.OpenBolt(cfg.DBPath)
+	if err != nil {
+		log.Fatal("Failed to open database:", err)
+	}
+	defer db.Close()
+	history = newGameHistory(db)
+	winStreaks, err = db.Streaks()
+	if err != nil {
+		log.Fatal("Failed to load streaks:", err)
+	}
 
-	tokenInstance, err = token.NewToken(common.HexToAddress(tokenAddress), client)
+	tokenInstance, err = token.NewToken(cfg.TokenAddress, client)
 	if err != nil {
 		log.Fatal("Failed to bind token contract:", err)
 	}
 
-	gameInstance, err = game.NewGame(common.HexToAddress(gameAddress), client)
+	gameInstance, err = game.NewGame(cfg.GameAddress, client)
 	if err != nil {
 		log.Fatal("Failed to bind game contract:", err)
 	}
 
-	go watchGameEvents()
+	unitCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	units, err = amount.Load(unitCtx, tokenInstance)
+	if err == nil {
+		tokenStats, err = loadTokenInfo(unitCtx)
+	}
+	cancel()
+	if err != nil {
+		log.Fatal("Failed to read token metadata: ", err)
+	}
+	if err := cfg.ResolveAmounts(units); err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+	log.Printf("Token %s has %d decimals; bet %s, bonus %s", units.Symbol, units.Decimals, units.Value(cfg.BetAmount), units.Value(cfg.BonusAmount))
+
+	if err := verifyWiring(); err != nil {
+		log.Fatal("Integrity check failed: ", err)
+	}
+
+	txWaiter = txmgr.NewWaiter(client, cfg.TxConfirmations, cfg.TxTimeout)
+	feePolicy = newFeePolicy(cfg)
+
+	revertDecoder, err = reverts.NewDecoder(cfg.GameAddress)
+	if err != nil {
+		log.Fatal("Failed to load revert decoder:", err)
+	}
+
+	playerRelay, err = relay.New(client, new(big.Int).SetUint64(cfg.ChainID), cfg.TokenAddress, cfg.GameAddress,
+		&txmgr.FeePolicy{GasLimits: feePolicy.GasLimits})
+	if err != nil {
+		log.Fatal("Failed to set up relay:", err)
+	}
+
+	intentVerifier = intents.NewVerifier(cfg.ChainID, cfg.GameAddress)
+	siweVerifier = siwe.NewVerifier(cfg.SIWEDomain, cfg.ChainID)
+	sessions = session.NewIssuer(cfg.SessionSecret, cfg.SessionTTL, cfg.SIWEDomain)
+
+	if cfg.ENSRegistry != (common.Address{}) {
+		ensCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		ensResolver, err = ens.New(ensCtx, client, cfg.ENSRegistry, cfg.ENSCacheTTL)
+		cancel()
+		if err != nil {
+			log.Println("ENS disabled:", err)
+		}
+	}
+
+	eventRouter, err := newEventRouter()
+	if err != nil {
+		log.Fatal("Failed to set up event handlers:", err)
+	}
+
+	if *runBackfill {
+		// Streaks are rebuilt from scratch, so the scan has to see every
+		// Win and Loss since the Game was deployed.
+		from := cfg.DeployBlock
+		if *fromBlock != 0 {
+			if cfg.DeployBlock != 0 && *fromBlock > cfg.DeployBlock {
+				log.Fatalf("-from-block %d is after deploy_block %d; a partial backfill would reset win streaks", *fromBlock, cfg.DeployBlock)
+			}
+			from = *fromBlock
+		}
+		to, err := backfillTarget(context.Background(), cfg.EventConfirmations)
+		if err != nil {
+			log.Fatal("Failed to read chain head:", err)
+		}
+		if err := backfill(context.Background(), from, to, cfg.EventChunkSize); err != nil {
+			log.Fatal("Backfill failed:", err)
+		}
+		winStreaks, err = db.Streaks()
+		if err != nil {
+			log.Fatal("Failed to load streaks:", err)
+		}
+	}
+
+	payoutEngine = payouts.New(db, payoutChain{confirmations: cfg.TxConfirmations})
+	if !readOnly {
+		go payoutEngine.Run(context.Background())
+	}
+
+	cursor, err := db.Cursor(eventCursor)
+	if err != nil {
+		log.Fatal("Failed to load event cursor:", err)
+	}
+	go watchGameEvents(eventRouter, cursor, cfg.EventConfirmations, cfg.EventPollInterval, cfg.EventChunkSize)
 
 	router := gin.Default()
-	router.POST("/play", playHandler)
-	router.GET("/mint", mintHandler)
-	router.GET("/balance/:address", balanceHandler)
-	router.GET("/history", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gameLogs)
-	})
+	router.Use(sessionAuth)
+	router.GET("/auth/nonce", nonceHandler)
+	router.POST("/auth/login", loginHandler)
+	router.POST("/auth/logout", logoutHandler)
+	router.GET("/integrity", integrityHandler)
+	router.GET("/network", networkHandler)
+	router.GET("/token", tokenHandler)
+	router.GET("/tx/:hash", txStatusHandler)
+
+	// Everything below acts on or reveals a player's data, so the caller
+	// must be signed in as that player.
+	player := router.Group("/", requireSession)
+	player.GET("/auth/me", meHandler)
+	player.POST("/play", writable, playHandler)
+	player.GET("/play/intent/:address", ownsParam("address"), intentHandler)
+	player.GET("/balance/:address", ownsParam("address"), balanceHandler)
+	player.GET("/history", historyHandler)
+	player.POST("/tx/approve", buildApproveHandler)
+	player.POST("/tx/play", buildPlayHandler)
+	player.POST("/tx/submit", submitTxHandler)
+
+	admin := router.Group("/admin", adminAuth(cfg.AdminToken))
+	admin.GET("/payouts", payoutsHandler)
+	admin.POST("/payouts/:trigger/retry", writable, retryPayoutHandler)
+	admin.POST("/withdraw", writable, withdrawHandler)
+	admin.POST("/mint", writable, mintHandler)
+	admin.GET("/mints", mintsHandler)
 
 	router.StaticFile("/", "./frontend/index.html")
-	router.Run(":8080")
+	router.Run(cfg.ListenAddr)
 }
 
 func playHandler(c *gin.Context) {
@@ -116,48 +240,66 @@ func playHandler(c *gin.Context) {
 		return
 	}
 
-	auth, err := bind.NewKeyedTransactorWithChainID(privateKey, big.NewInt(chainID))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "auth error"})
+	addr, ok := resolveAddress(c, "address", req.Address)
+	if !ok || !requireCaller(c, addr) {
 		return
 	}
+	player, ok := checkIntent(c, addr, req)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	bet := cfg.BetAmount
 
-	amount := new(big.Int).Mul(big.NewInt(10), big.NewInt(1e18))
-	approveTx, err := tokenInstance.Approve(auth, common.HexToAddress(gameAddress), amount)
+	// approve sets rather than adds to the allowance, so a second /play must
+	// not slip its approve in between our approve and play.
+	playMu.Lock()
+	unlock := sync.OnceFunc(playMu.Unlock)
+	defer unlock()
+	approveTx, err := send(ctx, txmgr.OpApprove, func(auth *bind.TransactOpts) (*types.Transaction, error) {
+		return tokenInstance.Approve(auth, cfg.GameAddress, bet)
+	})
 	if err != nil {
 		log.Println("Approve error:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "approve failed"})
+		respondTxError(c, "approve failed", err)
 		return
 	}
 	log.Println("Approve tx hash:", approveTx.Hash().Hex())
 
-	time.Sleep(2 * time.Second)
-
-	allowance, err := tokenInstance.Allowance(nil, common.HexToAddress(publicAddr), common.HexToAddress(gameAddress))
+	approveReceipt, err := waitTx(ctx, approveTx)
 	if err != nil {
-		log.Println("Allowance check failed:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "allowance check failed"})
+		log.Println("Approve not confirmed:", err)
+		if errors.Is(err, txmgr.ErrReverted) {
+			respondRevert(c, "approve failed", revertDecoder.Replay(ctx, client, nonces.Account(), approveTx, approveReceipt))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "approve not confirmed", "approveTx": approveTx.Hash().Hex()})
 		return
 	}
-	log.Println("Allowance from sender to Game:", allowance.String())
 
-	allowance, err = tokenInstance.Allowance(nil, common.HexToAddress(publicAddr), common.HexToAddress(gameAddress))
+	allowance, err := tokenInstance.Allowance(nil, common.HexToAddress(publicAddr), cfg.GameAddress)
 	if err != nil {
 		log.Println("Allowance check failed:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "allowance check failed"})
+		return
 	}
-	log.Println("Current allowance:", allowance)
-
-	playTx, err := gameInstance.Play(auth, uint8(req.Guess))
+	log.Println("Allowance from sender to Game:", allowance.String())
 
+	playTx, err := send(ctx, txmgr.OpPlay, func(auth *bind.TransactOpts) (*types.Transaction, error) {
+		return gameInstance.Play(auth, uint8(req.Guess))
+	})
+	unlock()
 	if err != nil {
 		log.Println("Play error:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "play failed"})
+		respondTxError(c, "play failed", err)
 		return
 	}
 	log.Println("Play tx hash:", playTx.Hash().Hex())
 
 	logEntry := GameLog{
-		Address:   req.Address,
+		Address:   addr.Hex(),
+		Player:    player.Hex(),
 		Guess:     req.Guess,
 		Winning:   -1,
 		Result:    "submitted",
@@ -165,104 +307,117 @@ func playHandler(c *gin.Context) {
 		Timestamp: time.Now(),
 	}
 
-	if playTx != nil {
-		logEntry.TxHash = playTx.Hash().Hex()
+	history.Add(logEntry)
+
+	// Waited for even if the client goes away, so a replacement that gets
+	// mined is still rekeyed and its outcome lands on the history entry.
+	playReceipt, err := waitTx(context.WithoutCancel(ctx), playTx)
+	if playReceipt != nil {
+		history.Rekey(playTx.Hash(), playReceipt.TxHash)
+	}
+	if err != nil && !errors.Is(err, txmgr.ErrReverted) {
+		log.Println("Play not confirmed:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "play not confirmed",
+			"approve":   txmgr.Summarize(approveReceipt),
+			"approveTx": approveTx.Hash().Hex(),
+			"playTx":    playTx.Hash().Hex(),
+			"playTxUrl": cfg.Link("tx", playTx.Hash().Hex()),
+		})
+		return
 	}
 
-	gameLogs = append(gameLogs, logEntry)
+	resp := gin.H{
+		"result":       "confirmed",
+		"address":      addr.Hex(),
+		"guess":        req.Guess,
+		"bet":          units.Value(bet),
+		"approveTx":    approveTx.Hash().Hex(),
+		"approveTxUrl": cfg.Link("tx", approveTx.Hash().Hex()),
+		"playTx":       playReceipt.TxHash.Hex(),
+		"playTxUrl":    cfg.Link("tx", playReceipt.TxHash.Hex()),
+		"approve":      txmgr.Summarize(approveReceipt),
+		"play":         txmgr.Summarize(playReceipt),
+	}
+	if name := displayName(ctx, addr); name != "" {
+		resp["name"] = name
+	}
+	if err != nil {
+		rev := revertDecoder.Replay(ctx, client, nonces.Account(), playTx, playReceipt)
+		log.Println("Play failed on-chain:", rev)
+		resp["result"] = "reverted"
+		resp["code"] = rev.Code()
+		resp["reason"] = rev.Error()
+	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"result":    "submitted",
-		"guess":     req.Guess,
-		"approveTx": approveTx.Hash().Hex(),
-		"playTx":    playTx.Hash().Hex(),
-	})
+	c.JSON(http.StatusOK, resp)
 }
 
-func mintHandler(c *gin.Context) {
-	auth, err := bind.NewKeyedTransactorWithChainID(privateKey, big.NewInt(chainID))
+func historyHandler(c *gin.Context) {
+	logs, err := history.List()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "auth error"})
+		log.Println("History read failed:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "history unavailable"})
 		return
 	}
-
-	amount := new(big.Int).Mul(big.NewInt(1000), big.NewInt(1e18))
-	tx, err := tokenInstance.Mint(auth, common.HexToAddress(publicAddr), amount)
-	if err != nil {
-		log.Println("Mint failed:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "mint failed"})
-		return
+	// Only the caller's own plays: the address they played as, or the
+	// player recovered from their signature.
+	me := caller(c)
+	entries := []historyEntry{}
+	for _, l := range logs {
+		if sameAddress(l.Address, me) || sameAddress(l.Player, me) {
+			entries = append(entries, historyEntry{GameLog: l, Prize: units.ValueOf(l.Prize), TxURL: cfg.Link("tx", l.TxHash)})
+		}
 	}
-	log.Println("Mint tx hash:", tx.Hash().Hex())
-	c.JSON(http.StatusOK, gin.H{
-		"mintedTo": publicAddr,
-		"amount":   "1000 MTK",
-		"txHash":   tx.Hash().Hex(),
-	})
+	c.JSON(http.StatusOK, entries)
+}
+
+func sameAddress(s string, addr common.Address) bool {
+	return common.IsHexAddress(s) && common.HexToAddress(s) == addr
+}
+
+// historyEntry is a GameLog as served by /history, with its prize in both
+// forms and its explorer link.
+type historyEntry struct {
+	GameLog
+	Prize *amount.Value `json:"prize,omitempty"`
+	TxURL string        `json:"txUrl,omitempty"`
 }
 
 func balanceHandler(c *gin.Context) {
-	addr := c.Param("address")
-	balance, err := tokenInstance.BalanceOf(nil, common.HexToAddress(addr))
+	addr, ok := resolveAddress(c, "address", c.Param("address"))
+	if !ok {
+		return
+	}
+	balance, err := tokenInstance.BalanceOf(nil, addr)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "balance check failed"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"address": addr,
-		"balance": balance.String(),
-	})
-}
-
-func watchGameEvents() {
-	query := ethereum.FilterQuery{
-		Addresses: []common.Address{common.HexToAddress(gameAddress)},
+	resp := gin.H{
+		"address": addr.Hex(),
+		"balance": units.Value(balance),
 	}
-
-	logs := make(chan types.Log)
-	sub, err := client.SubscribeFilterLogs(context.Background(), query, logs)
-	if err != nil {
-		log.Println("Event watcher disabled (likely HTTP endpoint)")
-		return
+	if name := displayName(c.Request.Context(), addr); name != "" {
+		resp["name"] = name
 	}
+	c.JSON(http.StatusOK, resp)
+}
 
-	log.Println("Listening for game events...")
-
-	for {
-		select {
-		case err := <-sub.Err():
-			log.Println("Subscription error:", err)
-		case vLog := <-logs:
-			log.Printf("New event log received: %+v\n", vLog)
-
-			topic := vLog.Topics[0].Hex()
-
-			switch topic {
-			case topicGameWin:
-				addr := extractAddressFromTopic(vLog.Topics[1])
-				winStreaks[addr]++
-				log.Println("Win for", addr, "- streak:", winStreaks[addr])
-
-				if winStreaks[addr] == 3 {
-					auth, _ := bind.NewKeyedTransactorWithChainID(privateKey, big.NewInt(chainID))
-					tx, err := tokenInstance.Mint(auth, common.HexToAddress(addr), bonusAmount)
-					if err != nil {
-						log.Println("Bonus mint error:", err)
-					} else {
-						log.Println("Bonus 50 MTK minted to", addr, "tx:", tx.Hash().Hex())
-						winStreaks[addr] = 0
-					}
-				}
-
-			case topicGameLoss:
-				addr := extractAddressFromTopic(vLog.Topics[1])
-				winStreaks[addr] = 0
-				log.Println("Loss for", addr, "- streak reset")
-			}
-		}
+// respondTxError reports a failed contract call, using the decoded revert
+// reason when there is one.
+func respondTxError(c *gin.Context, message string, err error) {
+	if rev := revertDecoder.Decode(err); rev != nil {
+		respondRevert(c, message, rev)
+		return
 	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
 }
 
-func extractAddressFromTopic(topic common.Hash) string {
-	return common.BytesToAddress(topic.Bytes()[12:]).Hex()
+func respondRevert(c *gin.Context, message string, rev reverts.Error) {
+	c.JSON(rev.HTTPStatus(), gin.H{
+		"error":  message,
+		"code":   rev.Code(),
+		"reason": rev.Error(),
+	})
 }
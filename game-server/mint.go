@@ -0,0 +1,199 @@
+package main
+
+import (
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/gin-gonic/gin"
+
+	"github.com/exccrr/solidity-token-go-integration/game-server/amount"
+	"github.com/exccrr/solidity-token-go-integration/game-server/store"
+	"github.com/exccrr/solidity-token-go-integration/game-server/txmgr"
+)
+
+// mintMu serialises admin mints so two requests cannot both fit under the
+// window cap.
+var mintMu sync.Mutex
+
+type MintRequest struct {
+	To     string `json:"to"`
+	Amount string `json:"amount"`
+	Reason string `json:"reason"`
+}
+
+// mintHandler mints a decimal amount of MTK to a recipient, within the
+// per-call and rolling-window caps. Every request ends up in the audit log.
+func mintHandler(c *gin.Context) {
+	var req MintRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	to, ok := parseAddress(c, "to", req.To)
+	if !ok {
+		return
+	}
+	if req.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason is required"})
+		return
+	}
+	value, err := units.Parse(req.Amount)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if value.Sign() <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be positive"})
+		return
+	}
+
+	entry := store.Mint{
+		Caller:    c.GetString(adminKey),
+		Remote:    c.ClientIP(),
+		To:        to.Hex(),
+		Amount:    value.String(),
+		Reason:    req.Reason,
+		CreatedAt: time.Now(),
+	}
+
+	mintMu.Lock()
+	defer mintMu.Unlock()
+
+	if value.Cmp(cfg.MintMax) > 0 {
+		refuseMint(c, entry, "amount above the per-call cap", "MINT_CAP_EXCEEDED")
+		return
+	}
+	minted, err := mintedSince(entry.CreatedAt.Add(-cfg.MintWindow))
+	if err != nil {
+		log.Println("Mint audit read failed:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "mint audit unavailable"})
+		return
+	}
+	if new(big.Int).Add(minted, value).Cmp(cfg.MintWindowMax) > 0 {
+		refuseMint(c, entry, "amount above what is left of the window cap", "MINT_WINDOW_EXCEEDED")
+		return
+	}
+
+	// The entry is written before signing, and updated as the mint goes
+	// out, so a mint that reaches the chain is never missing from the log
+	// or from the window cap, even if the server dies half way.
+	entry.Status = store.MintPending
+	id, err := db.AddMint(entry)
+	if err != nil {
+		log.Println("Mint audit write failed:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "mint audit unavailable"})
+		return
+	}
+	entry.ID = id
+
+	ctx := c.Request.Context()
+	tx, err := signOnly(ctx, txmgr.OpMint, func(auth *bind.TransactOpts) (*types.Transaction, error) {
+		return tokenInstance.Mint(auth, to, value)
+	})
+	if err != nil {
+		log.Println("Mint failed:", err)
+		entry.Status, entry.Error = store.MintFailed, err.Error()
+		updateMint(entry)
+		respondTxError(c, "mint failed", err)
+		return
+	}
+	entry.TxHash = tx.Hash().Hex()
+	if err := db.UpdateMint(entry); err != nil {
+		log.Println("Mint audit write failed:", err)
+		nonces.Release(tx.Nonce())
+		entry.TxHash = ""
+		entry.Status, entry.Error = store.MintFailed, "audit write failed: "+err.Error()
+		updateMint(entry)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "mint audit unavailable"})
+		return
+	}
+	if err := broadcast(ctx, tx); err != nil {
+		log.Println("Mint failed:", err)
+		unsent(tx, err)
+		entry.Status, entry.Error = store.MintFailed, err.Error()
+		updateMint(entry)
+		respondTxError(c, "mint failed", err)
+		return
+	}
+	entry.Status = store.MintSent
+	updateMint(entry)
+	log.Println("Mint by", entry.Caller, "to", entry.To, "amount", units.Value(value), "tx hash:", entry.TxHash)
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":       id,
+		"mintedTo": to.Hex(),
+		"amount":   units.Value(value),
+		"reason":   req.Reason,
+		"txHash":   tx.Hash().Hex(),
+		"txUrl":    cfg.Link("tx", tx.Hash().Hex()),
+	})
+}
+
+func refuseMint(c *gin.Context, entry store.Mint, reason, code string) {
+	entry.Status, entry.Error = store.MintRefused, reason
+	auditMint(entry)
+	c.JSON(http.StatusForbidden, gin.H{"error": reason, "code": code})
+}
+
+// auditMint writes entry to the audit log. A failed write is logged in
+// full so the record is not lost.
+func auditMint(entry store.Mint) uint64 {
+	id, err := db.AddMint(entry)
+	if err != nil {
+		log.Printf("Mint audit write failed: %v: %+v", err, entry)
+	}
+	return id
+}
+
+// updateMint records the outcome of a logged mint, like auditMint.
+func updateMint(entry store.Mint) {
+	if err := db.UpdateMint(entry); err != nil {
+		log.Printf("Mint audit write failed: %v: %+v", err, entry)
+	}
+}
+
+// mintedSince sums the admin mints after since that are or may be on
+// chain: sent ones, even if they later revert, pending ones, and failed ones
+// whose transaction was signed, since the node may have taken it. This errs
+// on the side of the cap.
+func mintedSince(since time.Time) (*big.Int, error) {
+	mints, err := db.Mints()
+	if err != nil {
+		return nil, err
+	}
+	total := new(big.Int)
+	for _, m := range mints {
+		if m.Status == store.MintRefused || m.Status == store.MintFailed && m.TxHash == "" || m.CreatedAt.Before(since) {
+			continue
+		}
+		if n, ok := new(big.Int).SetString(m.Amount, 10); ok {
+			total.Add(total, n)
+		}
+	}
+	return total, nil
+}
+
+func mintsHandler(c *gin.Context) {
+	mints, err := db.Mints()
+	if err != nil {
+		log.Println("Mint audit read failed:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "mint audit unavailable"})
+		return
+	}
+	out := make([]mintEntry, len(mints))
+	for i, m := range mints {
+		out[i] = mintEntry{Mint: m, Amount: units.ValueOf(m.Amount)}
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// mintEntry is an audit log entry with its amount in both forms.
+type mintEntry struct {
+	store.Mint
+	Amount *amount.Value `json:"amount"`
+}
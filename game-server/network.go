@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/gin-gonic/gin"
+)
+
+// dialNode connects to the first RPC endpoint that is reachable, on the
+// configured chain and has both contracts deployed.
+func dialNode() (*ethclient.Client, error) {
+	var errs []error
+	for _, url := range cfg.RPCURLs {
+		c, err := ethclient.Dial(url)
+		if err != nil {
+			log.Println("RPC endpoint unavailable:", url, err)
+			errs = append(errs, err)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err = cfg.CheckChain(ctx, c)
+		cancel()
+		if err != nil {
+			log.Println("RPC endpoint rejected:", url, err)
+			c.Close()
+			errs = append(errs, err)
+			continue
+		}
+		log.Printf("Connected to %s (network %s, chain %d)", url, cfg.Network, cfg.ChainID)
+		return c, nil
+	}
+	return nil, errors.Join(errs...)
+}
+
+func networkHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"network":     cfg.Network,
+		"chainId":     cfg.ChainID,
+		"explorerUrl": cfg.ExplorerURL,
+		"token":       cfg.TokenAddress.Hex(),
+		"tokenUrl":    cfg.Link("address", cfg.TokenAddress.Hex()),
+		"game":        cfg.GameAddress.Hex(),
+		"gameUrl":     cfg.Link("address", cfg.GameAddress.Hex()),
+	})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/exccrr/solidity-token-go-integration/game-server/txmgr"
+)
+
+// payoutChain implements payouts.Chain on top of the shared signer, nonce
+// manager and fee policy.
+type payoutChain struct {
+	confirmations uint64
+}
+
+func (p payoutChain) SignMint(ctx context.Context, to common.Address, amount *big.Int) (*types.Transaction, error) {
+	return signOnly(ctx, txmgr.OpMint, func(auth *bind.TransactOpts) (*types.Transaction, error) {
+		return tokenInstance.Mint(auth, to, amount)
+	})
+}
+
+func (p payoutChain) Bump(ctx context.Context, tx *types.Transaction) (*types.Transaction, error) {
+	return signBump(ctx, tx)
+}
+
+// Broadcast commits the nonce SignMint reserved once the node has the
+// transaction.
+func (p payoutChain) Broadcast(ctx context.Context, tx *types.Transaction) error {
+	return broadcast(ctx, tx)
+}
+
+func (p payoutChain) Discard(tx *types.Transaction) {
+	nonces.Release(tx.Nonce())
+}
+
+func (p payoutChain) Receipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	return client.TransactionReceipt(ctx, hash)
+}
+
+func (p payoutChain) Confirmed(ctx context.Context, receipt *types.Receipt) (bool, error) {
+	head, err := client.BlockNumber(ctx)
+	if err != nil {
+		return false, err
+	}
+	need := p.confirmations
+	if need == 0 {
+		need = 1
+	}
+	return head+1 >= receipt.BlockNumber.Uint64()+need, nil
+}
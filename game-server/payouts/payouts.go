@@ -0,0 +1,379 @@
+// Package payouts pays streak bonuses from a persistent ledger. Each bonus
+// is keyed by the event that earned it, so recording it twice, or
+// restarting halfway through paying it, never pays it twice.
+package payouts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/exccrr/solidity-token-go-integration/game-server/store"
+)
+
+// Chain is how the engine talks to the Token contract.
+type Chain interface {
+	// SignMint returns a signed but not yet broadcast mint transaction.
+	// Its nonce is held until the transaction is broadcast or discarded.
+	SignMint(ctx context.Context, to common.Address, amount *big.Int) (*types.Transaction, error)
+	// Discard gives back the nonce of a signed transaction that will never
+	// be broadcast, so it does not leave a gap.
+	Discard(tx *types.Transaction)
+	// Bump returns tx re-signed at the same nonce with higher fees, not yet
+	// broadcast.
+	Bump(ctx context.Context, tx *types.Transaction) (*types.Transaction, error)
+	// Broadcast sends a signed transaction. Broadcasting the same
+	// transaction twice must not be an error.
+	Broadcast(ctx context.Context, tx *types.Transaction) error
+	// Receipt returns the receipt of a mined transaction, or
+	// ethereum.NotFound.
+	Receipt(ctx context.Context, hash common.Hash) (*types.Receipt, error)
+	// Confirmed reports whether the block holding receipt is deep enough.
+	Confirmed(ctx context.Context, receipt *types.Receipt) (bool, error)
+}
+
+// Engine owns the bonus ledger and the worker that settles it.
+type Engine struct {
+	store store.Store
+	chain Chain
+
+	// MaxAttempts is how many reverted or failed sends a bonus gets before
+	// it is dead-lettered.
+	MaxAttempts int
+	// Interval is how often the worker re-checks the ledger on its own.
+	Interval time.Duration
+	// ResendAfter is how long a sent payout may go without a receipt before
+	// its signed transaction is broadcast again.
+	ResendAfter time.Duration
+
+	mu   sync.Mutex
+	wake chan struct{}
+}
+
+// New returns an Engine. Call Run to start paying.
+func New(s store.Store, chain Chain) *Engine {
+	return &Engine{
+		store:       s,
+		chain:       chain,
+		MaxAttempts: 5,
+		Interval:    15 * time.Second,
+		ResendAfter: 2 * time.Minute,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Owe records that player earned amount for trigger. Recording the same
+// trigger again is a no-op, except that a cancelled bonus is owed again.
+func (e *Engine) Owe(trigger string, player common.Address, amount *big.Int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	b, err := e.store.Bonus(trigger)
+	switch {
+	case err == nil && b.Status != store.BonusCancelled:
+		return nil
+	case err == nil:
+		b.Status = store.BonusOwed
+		b.UpdatedAt = time.Now()
+	case errors.Is(err, store.ErrNotFound):
+		now := time.Now()
+		b = store.Bonus{
+			Trigger:   trigger,
+			Player:    player.Hex(),
+			Amount:    amount.String(),
+			Status:    store.BonusOwed,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+	default:
+		return err
+	}
+	if err := e.store.PutBonus(b); err != nil {
+		return err
+	}
+	e.poke()
+	return nil
+}
+
+// Cancel withdraws a bonus whose trigger was reorged out. It reports false
+// if the payout has already been sent and can no longer be stopped.
+func (e *Engine) Cancel(trigger string) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	b, err := e.store.Bonus(trigger)
+	if errors.Is(err, store.ErrNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	switch b.Status {
+	case store.BonusOwed, store.BonusDead, store.BonusCancelled:
+		b.Status = store.BonusCancelled
+		b.UpdatedAt = time.Now()
+		return true, e.store.PutBonus(b)
+	}
+	return false, nil
+}
+
+// Retry moves a dead-lettered bonus back to owed with a fresh attempt count.
+func (e *Engine) Retry(trigger string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	b, err := e.store.Bonus(trigger)
+	if err != nil {
+		return err
+	}
+	if b.Status != store.BonusDead {
+		return fmt.Errorf("bonus is %s, not %s", b.Status, store.BonusDead)
+	}
+	b.Status = store.BonusOwed
+	b.Attempts = 0
+	b.LastError = ""
+	b.UpdatedAt = time.Now()
+	if err := e.store.PutBonus(b); err != nil {
+		return err
+	}
+	e.poke()
+	return nil
+}
+
+// Run settles the ledger until ctx is cancelled.
+func (e *Engine) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.Interval)
+	defer ticker.Stop()
+	for {
+		e.settle(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-e.wake:
+		}
+	}
+}
+
+func (e *Engine) poke() {
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (e *Engine) settle(ctx context.Context) {
+	bonuses, err := e.store.Bonuses()
+	if err != nil {
+		log.Println("Payout ledger read failed:", err)
+		return
+	}
+	for _, b := range bonuses {
+		var err error
+		switch b.Status {
+		case store.BonusOwed:
+			err = e.send(ctx, b)
+		case store.BonusSent:
+			err = e.check(ctx, b)
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Println("Payout", b.Trigger, "to", b.Player, "failed:", err)
+		}
+	}
+}
+
+// send signs the mint, stores it and only then broadcasts it, so after a
+// crash the same transaction (and nonce) is re-sent rather than a new one.
+func (e *Engine) send(ctx context.Context, b store.Bonus) error {
+	amount, ok := new(big.Int).SetString(b.Amount, 10)
+	if !ok {
+		return e.fail(b, fmt.Errorf("bad amount %q", b.Amount), true)
+	}
+
+	tx, err := e.chain.SignMint(ctx, common.HexToAddress(b.Player), amount)
+	if err != nil {
+		return e.fail(b, err, false)
+	}
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		e.chain.Discard(tx)
+		return err
+	}
+
+	e.mu.Lock()
+	current, err := e.store.Bonus(b.Trigger)
+	if err == nil && current.Status != store.BonusOwed {
+		// Cancelled while we were signing.
+		e.mu.Unlock()
+		e.chain.Discard(tx)
+		return nil
+	}
+	b.Status = store.BonusSent
+	b.TxHash = tx.Hash().Hex()
+	b.RawTx = hexutil.Encode(raw)
+	b.Attempts++
+	b.UpdatedAt = time.Now()
+	err = e.store.PutBonus(b)
+	e.mu.Unlock()
+	if err != nil {
+		e.chain.Discard(tx)
+		return err
+	}
+
+	log.Println("Paying bonus", b.Amount, "to", b.Player, "tx:", b.TxHash)
+	if err := e.chain.Broadcast(ctx, tx); err != nil {
+		// Left as sent: check will retry the broadcast or notice the nonce
+		// was taken by something else.
+		return err
+	}
+	return e.accepted(b)
+}
+
+// accepted records that a node took one of b's transactions.
+func (e *Engine) accepted(b store.Bonus) error {
+	if b.Accepted {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	b.Accepted = true
+	return e.store.PutBonus(b)
+}
+
+// check follows a sent payout to confirmation. Whichever of its
+// transactions was mined counts.
+func (e *Engine) check(ctx context.Context, b store.Bonus) error {
+	var receipt *types.Receipt
+	for _, hash := range append([]string{b.TxHash}, b.PrevTxHashes...) {
+		r, err := e.chain.Receipt(ctx, common.HexToHash(hash))
+		if errors.Is(err, ethereum.NotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		receipt = r
+		b.TxHash = hash
+		break
+	}
+	if receipt == nil {
+		return e.resend(ctx, b)
+	}
+
+	ok, err := e.chain.Confirmed(ctx, receipt)
+	if err != nil || !ok {
+		return err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return e.fail(b, errors.New("mint reverted"), false)
+	}
+
+	b.Status = store.BonusPaid
+	b.LastError = ""
+	b.UpdatedAt = time.Now()
+	log.Println("Bonus paid to", b.Player, "tx:", b.TxHash)
+	return e.store.PutBonus(b)
+}
+
+// resend replaces the transaction of a payout that has gone quiet with one
+// at the same nonce and higher fees, so a mint priced out by a base-fee rise
+// does not hold up every later transaction. The replacement is stored
+// before it is broadcast, like the original.
+//
+// If the nonce has been used by a transaction that is not one of ours it
+// can never be mined, but whether the mint happened under another hash is
+// unknown, so it is dead-lettered for a human instead of being paid again.
+// Any other error counts as an attempt; a payout that runs out of attempts
+// is dead-lettered too, and never returned to owed, since a transaction
+// already sent for it may still be mined.
+func (e *Engine) resend(ctx context.Context, b store.Bonus) error {
+	if time.Since(b.UpdatedAt) < e.ResendAfter {
+		return nil
+	}
+	data, err := hexutil.Decode(b.RawTx)
+	if err != nil {
+		return e.fail(b, fmt.Errorf("stored transaction: %w", err), true)
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(data); err != nil {
+		return e.fail(b, fmt.Errorf("stored transaction: %w", err), true)
+	}
+
+	replacement, err := e.chain.Bump(ctx, tx)
+	if err == nil {
+		raw, merr := replacement.MarshalBinary()
+		if merr != nil {
+			return merr
+		}
+		b.PrevTxHashes = append(b.PrevTxHashes, b.TxHash)
+		b.TxHash = replacement.Hash().Hex()
+		b.RawTx = hexutil.Encode(raw)
+		b.UpdatedAt = time.Now()
+		if err := e.store.PutBonus(b); err != nil {
+			return err
+		}
+		log.Println("Re-sending bonus to", b.Player, "as", b.TxHash, "fee cap", replacement.GasFeeCap())
+		err = e.chain.Broadcast(ctx, replacement)
+	}
+	if err == nil {
+		return e.accepted(b)
+	}
+	if strings.Contains(strings.ToLower(err.Error()), "nonce too low") {
+		return e.fail(b, fmt.Errorf("nonce %d reused by another transaction", tx.Nonce()), true)
+	}
+	return e.failSent(b, tx, err)
+}
+
+// failSent records err against a sent payout, which stays sent until it
+// runs out of attempts and is dead-lettered. A payout no node ever took
+// gives its nonce back when it is dead-lettered, or every later transaction
+// would queue behind a nonce that is never mined.
+func (e *Engine) failSent(b store.Bonus, tx *types.Transaction, cause error) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	b.Attempts++
+	b.LastError = cause.Error()
+	b.UpdatedAt = time.Now()
+	if b.Attempts >= e.MaxAttempts {
+		b.Status = store.BonusDead
+	}
+	if err := e.store.PutBonus(b); err != nil {
+		return err
+	}
+	if b.Status == store.BonusDead && !b.Accepted {
+		e.chain.Discard(tx)
+	}
+	return cause
+}
+
+// fail records err against b and either returns it to owed or, when out of
+// attempts or when dead is set, dead-letters it.
+func (e *Engine) fail(b store.Bonus, cause error, dead bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if b.Status == store.BonusOwed {
+		b.Attempts++
+	}
+	b.LastError = cause.Error()
+	b.UpdatedAt = time.Now()
+	b.Status = store.BonusOwed
+	if dead || b.Attempts >= e.MaxAttempts {
+		b.Status = store.BonusDead
+	}
+	if err := e.store.PutBonus(b); err != nil {
+		return err
+	}
+	return cause
+}
@@ -0,0 +1,208 @@
+package payouts
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/exccrr/solidity-token-go-integration/game-server/store"
+	"github.com/exccrr/solidity-token-go-integration/game-server/txmgr"
+)
+
+var player = common.HexToAddress("0x2000000000000000000000000000000000000002")
+
+// fakeNode is a node that has seen no transactions from the operator.
+type fakeNode struct{}
+
+func (fakeNode) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	return 0, nil
+}
+
+// fakeChain hands out unsigned transactions; the tests only look at their
+// hashes, nonces and fees. Nonces come from a real NonceManager, used the
+// way payoutChain uses it.
+type fakeChain struct {
+	nonces    *txmgr.NonceManager
+	signed    int
+	onSign    func()
+	discarded []uint64
+	sent      []*types.Transaction
+	sendErr   error
+	receipts  map[common.Hash]*types.Receipt
+}
+
+func newFakeChain() *fakeChain {
+	return &fakeChain{
+		nonces:   txmgr.NewNonceManager(fakeNode{}, common.Address{}),
+		receipts: map[common.Hash]*types.Receipt{},
+	}
+}
+
+func (f *fakeChain) SignMint(ctx context.Context, to common.Address, amount *big.Int) (*types.Transaction, error) {
+	if f.onSign != nil {
+		f.onSign()
+	}
+	nonce, err := f.nonces.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f.signed++
+	return types.NewTx(&types.DynamicFeeTx{Nonce: nonce, GasFeeCap: big.NewInt(100), GasTipCap: big.NewInt(1), To: &to}), nil
+}
+
+func (f *fakeChain) Discard(tx *types.Transaction) {
+	f.discarded = append(f.discarded, tx.Nonce())
+	f.nonces.Release(tx.Nonce())
+}
+
+func (f *fakeChain) Bump(ctx context.Context, tx *types.Transaction) (*types.Transaction, error) {
+	return types.NewTx(&types.DynamicFeeTx{
+		Nonce:     tx.Nonce(),
+		GasFeeCap: new(big.Int).Add(tx.GasFeeCap(), big.NewInt(10)),
+		GasTipCap: tx.GasTipCap(),
+		To:        tx.To(),
+	}), nil
+}
+
+func (f *fakeChain) Broadcast(ctx context.Context, tx *types.Transaction) error {
+	if f.sendErr != nil {
+		return f.sendErr
+	}
+	f.sent = append(f.sent, tx)
+	f.nonces.Commit(tx.Nonce())
+	return nil
+}
+
+func (f *fakeChain) Receipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	if r, ok := f.receipts[hash]; ok {
+		return r, nil
+	}
+	return nil, ethereum.NotFound
+}
+
+func (f *fakeChain) Confirmed(ctx context.Context, receipt *types.Receipt) (bool, error) {
+	return true, nil
+}
+
+func newTestEngine(t *testing.T, chain *fakeChain) (*Engine, store.Store) {
+	t.Helper()
+	db, err := store.OpenBolt(filepath.Join(t.TempDir(), "payouts.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	e := New(db, chain)
+	e.ResendAfter = 0
+	return e, db
+}
+
+func TestCancelWhileSigningReleasesNonce(t *testing.T) {
+	chain := newFakeChain()
+	e, db := newTestEngine(t, chain)
+	if err := e.Owe("win", player, big.NewInt(50)); err != nil {
+		t.Fatal(err)
+	}
+	chain.onSign = func() {
+		if ok, err := e.Cancel("win"); err != nil || !ok {
+			t.Fatalf("cancel: %v %v", ok, err)
+		}
+	}
+
+	e.settle(context.Background())
+
+	if len(chain.sent) != 0 {
+		t.Fatal("cancelled bonus was broadcast")
+	}
+	if len(chain.discarded) != 1 || chain.discarded[0] != 0 {
+		t.Fatalf("discarded %v, want nonce 0 given back", chain.discarded)
+	}
+	b, _ := db.Bonus("win")
+	if b.Status != store.BonusCancelled {
+		t.Fatalf("status %s, want cancelled", b.Status)
+	}
+}
+
+func TestResendBumpsFeesAndKeepsOldHash(t *testing.T) {
+	chain := newFakeChain()
+	e, db := newTestEngine(t, chain)
+	if err := e.Owe("win", player, big.NewInt(50)); err != nil {
+		t.Fatal(err)
+	}
+	e.settle(context.Background()) // send
+	e.settle(context.Background()) // no receipt: bump
+
+	if len(chain.sent) != 2 {
+		t.Fatalf("broadcast %d transactions, want original and replacement", len(chain.sent))
+	}
+	original, replacement := chain.sent[0], chain.sent[1]
+	if replacement.Nonce() != original.Nonce() || replacement.GasFeeCap().Cmp(original.GasFeeCap()) <= 0 {
+		t.Fatal("replacement is not the same nonce at a higher fee")
+	}
+	b, _ := db.Bonus("win")
+	if b.TxHash != replacement.Hash().Hex() || len(b.PrevTxHashes) != 1 || b.PrevTxHashes[0] != original.Hash().Hex() {
+		t.Fatalf("ledger has %s replacing %v", b.TxHash, b.PrevTxHashes)
+	}
+
+	// The original wins the race and is mined after all.
+	chain.receipts[original.Hash()] = &types.Receipt{Status: types.ReceiptStatusSuccessful, BlockNumber: big.NewInt(1)}
+	e.settle(context.Background())
+	b, _ = db.Bonus("win")
+	if b.Status != store.BonusPaid || b.TxHash != original.Hash().Hex() {
+		t.Fatalf("status %s tx %s, want paid by the original", b.Status, b.TxHash)
+	}
+}
+
+func TestResendDeadLettersRepeatedErrors(t *testing.T) {
+	chain := newFakeChain()
+	e, db := newTestEngine(t, chain)
+	if err := e.Owe("win", player, big.NewInt(50)); err != nil {
+		t.Fatal(err)
+	}
+	e.settle(context.Background())
+
+	chain.sendErr = errors.New("max fee per gas less than block base fee")
+	for i := 0; i < e.MaxAttempts; i++ {
+		e.settle(context.Background())
+	}
+	b, _ := db.Bonus("win")
+	if b.Status != store.BonusDead {
+		t.Fatalf("status %s after %d failed resends, want dead", b.Status, e.MaxAttempts)
+	}
+	if chain.signed != 1 {
+		t.Fatal("a sent payout was signed again under a new nonce")
+	}
+	if len(chain.discarded) != 0 {
+		t.Fatal("gave back the nonce of a payout a node accepted")
+	}
+}
+
+func TestDeadLetterReleasesUnsentNonce(t *testing.T) {
+	chain := newFakeChain()
+	chain.sendErr = errors.New("max fee per gas less than block base fee")
+	e, db := newTestEngine(t, chain)
+	if err := e.Owe("win", player, big.NewInt(50)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < e.MaxAttempts; i++ {
+		e.settle(context.Background())
+	}
+	b, _ := db.Bonus("win")
+	if b.Status != store.BonusDead {
+		t.Fatalf("status %s, want dead", b.Status)
+	}
+
+	// No node ever took the payout, so the next transaction fills its nonce.
+	n, err := chain.nonces.Next(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("next nonce %d, want the dead payout's 0 reused", n)
+	}
+}
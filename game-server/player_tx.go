@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/gin-gonic/gin"
+
+	"github.com/exccrr/solidity-token-go-integration/game-server/relay"
+	"github.com/exccrr/solidity-token-go-integration/game-server/txmgr"
+)
+
+var playerRelay *relay.Relay
+
+type BuildRequest struct {
+	Player string `json:"player"`
+	Guess  int    `json:"guess"`
+}
+
+type SubmitRequest struct {
+	Raw hexutil.Bytes `json:"raw"`
+}
+
+func buildApproveHandler(c *gin.Context) {
+	var req BuildRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	player, ok := resolveAddress(c, "player", req.Player)
+	if !ok || !requireCaller(c, player) {
+		return
+	}
+	built, err := playerRelay.BuildApprove(c.Request.Context(), player, cfg.BetAmount)
+	if err != nil {
+		log.Println("Build approve failed:", err)
+		respondTxError(c, "build failed", err)
+		return
+	}
+	c.JSON(http.StatusOK, built)
+}
+
+func buildPlayHandler(c *gin.Context) {
+	var req BuildRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	if req.Guess < 1 || req.Guess > 10 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "guess must be between 1 and 10"})
+		return
+	}
+	player, ok := resolveAddress(c, "player", req.Player)
+	if !ok || !requireCaller(c, player) {
+		return
+	}
+	built, err := playerRelay.BuildPlay(c.Request.Context(), player, uint8(req.Guess))
+	if err != nil {
+		log.Println("Build play failed:", err)
+		respondTxError(c, "build failed", err)
+		return
+	}
+	c.JSON(http.StatusOK, built)
+}
+
+// submitTxHandler relays a transaction the player signed from a build.
+// Plays are added to the history right away and resolved by the event
+// watcher like the server's own.
+func submitTxHandler(c *gin.Context) {
+	var req SubmitRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Raw) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	tx, built, err := playerRelay.Submit(c.Request.Context(), req.Raw, caller(c))
+	switch {
+	case errors.Is(err, relay.ErrNotBuilt):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, relay.ErrMismatch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Println("Relay failed:", err)
+		respondTxError(c, "broadcast failed", err)
+		return
+	}
+	log.Println("Relayed", built.Kind, "from", built.From.Hex(), "tx hash:", tx.Hash().Hex())
+
+	if built.Kind == relay.KindPlay {
+		history.Add(GameLog{
+			Address:   built.From.Hex(),
+			Guess:     int(built.Guess),
+			Winning:   -1,
+			Result:    "submitted",
+			TxHash:    tx.Hash().Hex(),
+			Timestamp: time.Now(),
+		})
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"kind":   built.Kind,
+		"from":   built.From.Hex(),
+		"txHash": tx.Hash().Hex(),
+		"txUrl":  cfg.Link("tx", tx.Hash().Hex()),
+	})
+}
+
+// txStatusHandler reports whether a relayed (or any) transaction is
+// pending, confirmed or reverted. A hash the node does not know at all,
+// such as one that was dropped from the mempool, is unknown with a 404.
+func txStatusHandler(c *gin.Context) {
+	if _, err := hexutil.Decode(c.Param("hash")); err != nil || len(c.Param("hash")) != 66 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid transaction hash"})
+		return
+	}
+	hash := common.HexToHash(c.Param("hash"))
+	ctx := c.Request.Context()
+
+	receipt, err := client.TransactionReceipt(ctx, hash)
+	if errors.Is(err, ethereum.NotFound) {
+		// No receipt yet: pending if the node has the transaction, mined
+		// or not, since the receipt can lag the block.
+		_, _, err = client.TransactionByHash(ctx, hash)
+		switch {
+		case errors.Is(err, ethereum.NotFound):
+			c.JSON(http.StatusNotFound, gin.H{"txHash": hash.Hex(), "status": "unknown", "error": "transaction not found"})
+		case err != nil:
+			log.Println("Transaction lookup failed:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "transaction lookup failed"})
+		default:
+			c.JSON(http.StatusOK, gin.H{"txHash": hash.Hex(), "status": "pending", "txUrl": cfg.Link("tx", hash.Hex())})
+		}
+		return
+	}
+	if err != nil {
+		log.Println("Receipt lookup failed:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "receipt lookup failed"})
+		return
+	}
+	head, err := client.BlockNumber(ctx)
+	if err != nil {
+		log.Println("Head lookup failed:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "receipt lookup failed"})
+		return
+	}
+
+	// With load-balanced RPC the receipt can come from a node ahead of the
+	// one that answered the head.
+	var confirmations uint64
+	if block := receipt.BlockNumber.Uint64(); head+1 >= block {
+		confirmations = head + 1 - block
+	}
+	status := "mined"
+	switch {
+	case receipt.Status == 0:
+		status = "reverted"
+	case confirmations >= max(cfg.TxConfirmations, 1):
+		status = "confirmed"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"txHash":        hash.Hex(),
+		"status":        status,
+		"confirmations": confirmations,
+		"receipt":       txmgr.Summarize(receipt),
+		"txUrl":         cfg.Link("tx", hash.Hex()),
+	})
+}
@@ -0,0 +1,243 @@
+// Package relay builds unsigned transactions for players to sign in their
+// own wallets, and checks and broadcasts what they sign. Players then stake
+// their own tokens instead of the server playing for them.
+package relay
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/exccrr/solidity-token-go-integration/game-server/game"
+	"github.com/exccrr/solidity-token-go-integration/game-server/token"
+	"github.com/exccrr/solidity-token-go-integration/game-server/txmgr"
+)
+
+// Kinds of transaction the relay builds.
+const (
+	KindApprove = "approve"
+	KindPlay    = "play"
+)
+
+var (
+	// ErrNotBuilt is returned by Submit for a transaction the relay did not
+	// build, or whose build has expired or was already submitted.
+	ErrNotBuilt = errors.New("no matching transaction was built for this sender and nonce")
+	// ErrMismatch is returned by Submit when the signed transaction differs
+	// from the build in anything but gas and fees.
+	ErrMismatch = errors.New("signed transaction does not match the built one")
+)
+
+// Backend is what the relay needs from the node.
+type Backend interface {
+	txmgr.FeeBackend
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+	EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error)
+	SendTransaction(ctx context.Context, tx *types.Transaction) error
+}
+
+// Built is an unsigned EIP-1559 transaction waiting for the player's
+// signature. Wallets may change the gas and fee fields before signing.
+type Built struct {
+	Kind                 string         `json:"kind"`
+	ChainID              *hexutil.Big   `json:"chainId"`
+	From                 common.Address `json:"from"`
+	To                   common.Address `json:"to"`
+	Nonce                hexutil.Uint64 `json:"nonce"`
+	Gas                  hexutil.Uint64 `json:"gas"`
+	GasEstimated         bool           `json:"gasEstimated"`
+	MaxFeePerGas         *hexutil.Big   `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexutil.Big   `json:"maxPriorityFeePerGas"`
+	Value                *hexutil.Big   `json:"value"`
+	Data                 hexutil.Bytes  `json:"data"`
+	Type                 hexutil.Uint64 `json:"type"`
+	Expires              time.Time      `json:"expires"`
+
+	// Guess is set for play transactions.
+	Guess uint8 `json:"guess,omitempty"`
+}
+
+type buildKey struct {
+	from  common.Address
+	nonce uint64
+}
+
+// Relay builds and relays player transactions for one Token/Game pair.
+type Relay struct {
+	backend  Backend
+	chainID  *big.Int
+	token    common.Address
+	game     common.Address
+	tokenABI *abi.ABI
+	gameABI  *abi.ABI
+	fees     *txmgr.FeePolicy
+
+	// TTL is how long a build can be submitted.
+	TTL time.Duration
+
+	mu     sync.Mutex
+	builds map[buildKey]*Built
+}
+
+// New returns a relay. fees supplies the fee suggestion and, through its
+// gas limits, the fallback when a play cannot be estimated because its
+// approve is not mined yet. Its caps should be the player's, not the
+// operator's; a zero FeePolicy has none.
+func New(backend Backend, chainID *big.Int, tokenAddr, gameAddr common.Address, fees *txmgr.FeePolicy) (*Relay, error) {
+	tokenABI, err := token.TokenMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	gameABI, err := game.GameMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	return &Relay{
+		backend:  backend,
+		chainID:  chainID,
+		token:    tokenAddr,
+		game:     gameAddr,
+		tokenABI: tokenABI,
+		gameABI:  gameABI,
+		fees:     fees,
+		TTL:      10 * time.Minute,
+		builds:   make(map[buildKey]*Built),
+	}, nil
+}
+
+// BuildApprove builds Token.approve(game, amount) from player.
+func (r *Relay) BuildApprove(ctx context.Context, player common.Address, amount *big.Int) (*Built, error) {
+	data, err := r.tokenABI.Pack("approve", r.game, amount)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := r.backend.PendingNonceAt(ctx, player)
+	if err != nil {
+		return nil, fmt.Errorf("read nonce: %w", err)
+	}
+	return r.build(ctx, KindApprove, txmgr.OpApprove, player, r.token, nonce, data, 0)
+}
+
+// BuildPlay builds Game.play(guess) from player. If an approve built for
+// the player is still waiting to be submitted, the play takes the next
+// nonce so both can be signed at once.
+func (r *Relay) BuildPlay(ctx context.Context, player common.Address, guess uint8) (*Built, error) {
+	data, err := r.gameABI.Pack("play", guess)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := r.backend.PendingNonceAt(ctx, player)
+	if err != nil {
+		return nil, fmt.Errorf("read nonce: %w", err)
+	}
+	r.mu.Lock()
+	r.pruneLocked()
+	for k, b := range r.builds {
+		if k.from == player && b.Kind == KindApprove && k.nonce >= nonce {
+			nonce = k.nonce + 1
+		}
+	}
+	r.mu.Unlock()
+	return r.build(ctx, KindPlay, txmgr.OpPlay, player, r.game, nonce, data, guess)
+}
+
+func (r *Relay) build(ctx context.Context, kind string, op txmgr.Operation, from, to common.Address, nonce uint64, data []byte, guess uint8) (*Built, error) {
+	feeCap, tip, err := r.fees.Suggest(ctx, r.backend)
+	if err != nil {
+		return nil, err
+	}
+
+	estimated := true
+	gas, err := r.backend.EstimateGas(ctx, ethereum.CallMsg{From: from, To: &to, Data: data})
+	if err != nil {
+		// A play estimated before its approve is mined reverts; use the
+		// configured limit and let the wallet or the chain have the final say.
+		if gas = r.fees.GasLimits[op]; gas == 0 || kind != KindPlay {
+			return nil, fmt.Errorf("estimate gas: %w", err)
+		}
+		estimated = false
+	}
+
+	b := &Built{
+		Kind:                 kind,
+		ChainID:              (*hexutil.Big)(r.chainID),
+		From:                 from,
+		To:                   to,
+		Nonce:                hexutil.Uint64(nonce),
+		Gas:                  hexutil.Uint64(gas),
+		GasEstimated:         estimated,
+		MaxFeePerGas:         (*hexutil.Big)(feeCap),
+		MaxPriorityFeePerGas: (*hexutil.Big)(tip),
+		Value:                (*hexutil.Big)(new(big.Int)),
+		Data:                 data,
+		Type:                 types.DynamicFeeTxType,
+		Expires:              time.Now().Add(r.TTL),
+		Guess:                guess,
+	}
+	r.mu.Lock()
+	r.builds[buildKey{from, nonce}] = b
+	r.mu.Unlock()
+	return b, nil
+}
+
+// Submit checks a signed raw transaction from sender against its build
+// and broadcasts it. Gas and fee fields may differ from the build; sender,
+// nonce, recipient, value and calldata may not.
+func (r *Relay) Submit(ctx context.Context, raw []byte, sender common.Address) (*types.Transaction, *Built, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return nil, nil, fmt.Errorf("%w: invalid raw transaction: %v", ErrMismatch, err)
+	}
+	if tx.Type() != types.DynamicFeeTxType {
+		return nil, nil, fmt.Errorf("%w: not an EIP-1559 transaction", ErrMismatch)
+	}
+	if tx.ChainId().Cmp(r.chainID) != 0 {
+		return nil, nil, fmt.Errorf("%w: chain ID %s", ErrMismatch, tx.ChainId())
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(r.chainID), tx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrMismatch, err)
+	}
+	if from != sender {
+		return nil, nil, fmt.Errorf("%w: signed by %s", ErrMismatch, from.Hex())
+	}
+
+	key := buildKey{from, tx.Nonce()}
+	r.mu.Lock()
+	r.pruneLocked()
+	b, ok := r.builds[key]
+	r.mu.Unlock()
+	if !ok {
+		return nil, nil, ErrNotBuilt
+	}
+	if tx.To() == nil || *tx.To() != b.To || !bytes.Equal(tx.Data(), b.Data) || tx.Value().Sign() != 0 {
+		return nil, nil, ErrMismatch
+	}
+
+	if err := r.backend.SendTransaction(ctx, tx); err != nil {
+		return nil, nil, err
+	}
+	r.mu.Lock()
+	delete(r.builds, key)
+	r.mu.Unlock()
+	return tx, b, nil
+}
+
+func (r *Relay) pruneLocked() {
+	now := time.Now()
+	for k, b := range r.builds {
+		if now.After(b.Expires) {
+			delete(r.builds, k)
+		}
+	}
+}
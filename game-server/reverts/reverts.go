@@ -0,0 +1,275 @@
+// Package reverts turns revert data from the Game and Token contracts into
+// typed Go errors with stable API error codes.
+package reverts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/exccrr/solidity-token-go-integration/game-server/token"
+)
+
+// API error codes returned to clients.
+const (
+	CodeGuessOutOfRange       = "GUESS_OUT_OF_RANGE"
+	CodePaymentFailed         = "PAYMENT_FAILED"
+	CodePrizeTransferFailed   = "PRIZE_TRANSFER_FAILED"
+	CodeOnlyOwner             = "ONLY_OWNER"
+	CodeInsufficientBalance   = "INSUFFICIENT_BALANCE"
+	CodeHouseBankrollEmpty    = "HOUSE_BANKROLL_EMPTY"
+	CodeInsufficientAllowance = "INSUFFICIENT_ALLOWANCE"
+	CodeUnauthorizedAccount   = "UNAUTHORIZED_ACCOUNT"
+	CodeUnknownRevert         = "UNKNOWN_REVERT"
+)
+
+// Error is implemented by every decoded revert.
+type Error interface {
+	error
+	Code() string
+	HTTPStatus() int
+}
+
+// ReasonError is a require() failure carrying an Error(string) message.
+type ReasonError struct {
+	Reason string
+	code   string
+	status int
+}
+
+func (e *ReasonError) Error() string   { return "execution reverted: " + e.Reason }
+func (e *ReasonError) Code() string    { return e.code }
+func (e *ReasonError) HTTPStatus() int { return e.status }
+
+// Is matches two ReasonErrors with the same code, so callers can compare
+// against the sentinels below with errors.Is.
+func (e *ReasonError) Is(target error) bool {
+	t, ok := target.(*ReasonError)
+	return ok && t.code == e.code
+}
+
+// Sentinels for the require() messages in game.sol.
+var (
+	ErrGuessOutOfRange     = &ReasonError{Reason: "Guess out of range", code: CodeGuessOutOfRange, status: http.StatusBadRequest}
+	ErrPaymentFailed       = &ReasonError{Reason: "Payment failed", code: CodePaymentFailed, status: http.StatusPaymentRequired}
+	ErrPrizeTransferFailed = &ReasonError{Reason: "Prize transfer failed", code: CodePrizeTransferFailed, status: http.StatusServiceUnavailable}
+	ErrOnlyOwner           = &ReasonError{Reason: "Only owner can withdraw", code: CodeOnlyOwner, status: http.StatusForbidden}
+)
+
+var knownReasons = []*ReasonError{ErrGuessOutOfRange, ErrPaymentFailed, ErrPrizeTransferFailed, ErrOnlyOwner}
+
+// InsufficientBalanceError is ERC20InsufficientBalance. When Sender is the
+// Game contract the house cannot cover the prize.
+type InsufficientBalanceError struct {
+	Sender  common.Address
+	Balance *big.Int
+	Needed  *big.Int
+	House   bool
+}
+
+func (e *InsufficientBalanceError) Error() string {
+	return fmt.Sprintf("ERC20InsufficientBalance(%s, %s, %s)", e.Sender.Hex(), e.Balance, e.Needed)
+}
+
+func (e *InsufficientBalanceError) Code() string {
+	if e.House {
+		return CodeHouseBankrollEmpty
+	}
+	return CodeInsufficientBalance
+}
+
+func (e *InsufficientBalanceError) HTTPStatus() int {
+	if e.House {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusPaymentRequired
+}
+
+// InsufficientAllowanceError is ERC20InsufficientAllowance.
+type InsufficientAllowanceError struct {
+	Spender   common.Address
+	Allowance *big.Int
+	Needed    *big.Int
+}
+
+func (e *InsufficientAllowanceError) Error() string {
+	return fmt.Sprintf("ERC20InsufficientAllowance(%s, %s, %s)", e.Spender.Hex(), e.Allowance, e.Needed)
+}
+
+func (e *InsufficientAllowanceError) Code() string    { return CodeInsufficientAllowance }
+func (e *InsufficientAllowanceError) HTTPStatus() int { return http.StatusConflict }
+
+// UnauthorizedAccountError is OwnableUnauthorizedAccount.
+type UnauthorizedAccountError struct {
+	Account common.Address
+}
+
+func (e *UnauthorizedAccountError) Error() string {
+	return fmt.Sprintf("OwnableUnauthorizedAccount(%s)", e.Account.Hex())
+}
+
+func (e *UnauthorizedAccountError) Code() string    { return CodeUnauthorizedAccount }
+func (e *UnauthorizedAccountError) HTTPStatus() int { return http.StatusForbidden }
+
+// UnknownError is a revert the decoder does not recognise.
+type UnknownError struct {
+	Data   []byte
+	Reason string
+}
+
+func (e *UnknownError) Error() string {
+	if e.Reason != "" {
+		return "execution reverted: " + e.Reason
+	}
+	return "execution reverted: " + hexutil.Encode(e.Data)
+}
+
+func (e *UnknownError) Code() string    { return CodeUnknownRevert }
+func (e *UnknownError) HTTPStatus() int { return http.StatusUnprocessableEntity }
+
+// Decoder recognises reverts raised by the Game and Token contracts.
+type Decoder struct {
+	game   common.Address
+	errors map[[4]byte]abi.Error
+}
+
+// NewDecoder builds a Decoder from the Token ABI. game is used to tell an
+// empty house bankroll apart from a player without funds.
+func NewDecoder(game common.Address) (*Decoder, error) {
+	parsed, err := token.TokenMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	d := &Decoder{game: game, errors: make(map[[4]byte]abi.Error)}
+	for _, e := range parsed.Errors {
+		var id [4]byte
+		copy(id[:], e.ID[:4])
+		d.errors[id] = e
+	}
+	return d, nil
+}
+
+// Decode returns the typed revert behind err, or nil when err does not carry
+// revert data.
+func (d *Decoder) Decode(err error) Error {
+	if err == nil {
+		return nil
+	}
+	var dataErr rpc.DataError
+	if errors.As(err, &dataErr) {
+		if data := revertData(dataErr.ErrorData()); len(data) > 0 {
+			return d.DecodeData(data)
+		}
+	}
+	// Some providers only report the reason in the message.
+	if msg := err.Error(); strings.Contains(msg, "execution reverted") {
+		for _, known := range knownReasons {
+			if strings.Contains(msg, known.Reason) {
+				return known
+			}
+		}
+		return &UnknownError{Reason: strings.TrimSpace(strings.TrimPrefix(msg, "execution reverted:"))}
+	}
+	return nil
+}
+
+// DecodeData decodes raw revert return data.
+func (d *Decoder) DecodeData(data []byte) Error {
+	if reason, err := abi.UnpackRevert(data); err == nil {
+		for _, known := range knownReasons {
+			if reason == known.Reason {
+				return known
+			}
+		}
+		return &UnknownError{Data: data, Reason: reason}
+	}
+	if len(data) < 4 {
+		return &UnknownError{Data: data}
+	}
+
+	var id [4]byte
+	copy(id[:], data[:4])
+	def, ok := d.errors[id]
+	if !ok {
+		return &UnknownError{Data: data}
+	}
+	args, err := def.Inputs.Unpack(data[4:])
+	if err != nil {
+		return &UnknownError{Data: data}
+	}
+
+	switch def.Name {
+	case "ERC20InsufficientBalance":
+		sender := args[0].(common.Address)
+		return &InsufficientBalanceError{
+			Sender:  sender,
+			Balance: args[1].(*big.Int),
+			Needed:  args[2].(*big.Int),
+			House:   sender == d.game,
+		}
+	case "ERC20InsufficientAllowance":
+		return &InsufficientAllowanceError{
+			Spender:   args[0].(common.Address),
+			Allowance: args[1].(*big.Int),
+			Needed:    args[2].(*big.Int),
+		}
+	case "OwnableUnauthorizedAccount":
+		return &UnauthorizedAccountError{Account: args[0].(common.Address)}
+	}
+	return &UnknownError{Data: data, Reason: def.Name}
+}
+
+// Replay re-executes a mined transaction against the state of its parent
+// block to recover the revert data, which receipts do not include.
+//
+// The replay does not see the transactions mined before tx in the same
+// block, so it can disagree with what actually happened: a play mined in
+// the same block as its approve is replayed without the allowance, and
+// another account's transfer just before tx is missed. Where the replay
+// succeeds the result is an UnknownError; debug_traceTransaction would be
+// exact, but few public nodes serve it.
+func (d *Decoder) Replay(ctx context.Context, caller ethereum.ContractCaller, from common.Address, tx *types.Transaction, receipt *types.Receipt) Error {
+	msg := ethereum.CallMsg{
+		From:  from,
+		To:    tx.To(),
+		Gas:   tx.Gas(),
+		Value: tx.Value(),
+		Data:  tx.Data(),
+	}
+	var block *big.Int
+	if receipt != nil && receipt.BlockNumber != nil && receipt.BlockNumber.Sign() > 0 {
+		block = new(big.Int).Sub(receipt.BlockNumber, big.NewInt(1))
+	}
+	_, err := caller.CallContract(ctx, msg, block)
+	if err == nil {
+		return &UnknownError{}
+	}
+	if decoded := d.Decode(err); decoded != nil {
+		return decoded
+	}
+	return &UnknownError{Reason: err.Error()}
+}
+
+func revertData(v interface{}) []byte {
+	switch data := v.(type) {
+	case string:
+		b, err := hexutil.Decode(data)
+		if err != nil {
+			return nil
+		}
+		return b
+	case []byte:
+		return data
+	}
+	return nil
+}
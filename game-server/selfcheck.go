@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/gin-gonic/gin"
+
+	"github.com/exccrr/solidity-token-go-integration/game-server/integrity"
+)
+
+var (
+	// readOnly is set when the server key cannot mint; write endpoints and
+	// the payout worker stay off, owed bonuses keep accumulating.
+	readOnly        bool
+	integrityReport *integrity.Report
+)
+
+// verifyWiring runs the startup self-check and decides whether the server
+// may start and whether it may send transactions.
+func verifyWiring() error {
+	tokenBin, err := loadTokenBin(cfg.TokenBin)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	report := integrity.Verify(ctx, client, cfg.GameAddress, cfg.TokenAddress, common.HexToAddress(publicAddr), tokenBin)
+	integrityReport = report
+	log.Printf("Contract wiring:\n%s", report)
+
+	if report.Failed(integrity.Critical) {
+		return errors.New("game and token contracts are not wired as expected")
+	}
+	if report.Failed(integrity.Write) {
+		if cfg.IntegrityMode != "read_only" {
+			return errors.New("server key cannot mint; set integrity_mode: read_only to serve reads anyway")
+		}
+		log.Println("Starting in read-only mode: server key cannot mint")
+		readOnly = true
+	}
+	return nil
+}
+
+// loadTokenBin reads the hex creation bytecode written by the compiler.
+func loadTokenBin(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Println("No Token build output at", path, "- skipping bytecode check")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(s, "0x") {
+		s = "0x" + s
+	}
+	return hexutil.Decode(s)
+}
+
+// writable rejects requests that would send a transaction while the server
+// is read-only.
+func writable(c *gin.Context) {
+	if readOnly {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "server is in read-only mode", "code": "READ_ONLY"})
+		return
+	}
+	c.Next()
+}
+
+func integrityHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"readOnly": readOnly,
+		"report":   integrityReport,
+	})
+}
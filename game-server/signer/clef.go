@@ -0,0 +1,94 @@
+package signer
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Clef signs through an external signer speaking Clef's account_ JSON-RPC
+// API. The key never enters this process.
+type Clef struct {
+	client  *rpc.Client
+	addr    common.Address
+	chainID *big.Int
+}
+
+// DialClef connects to the signer at url (http, ws or an IPC path) and
+// checks that it manages account.
+func DialClef(ctx context.Context, url string, account common.Address, chainID *big.Int) (*Clef, error) {
+	client, err := rpc.DialContext(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	var accounts []common.Address
+	if err := client.CallContext(ctx, &accounts, "account_list"); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("account_list: %w", err)
+	}
+	for _, a := range accounts {
+		if a == account {
+			return &Clef{client: client, addr: account, chainID: chainID}, nil
+		}
+	}
+	client.Close()
+	return nil, fmt.Errorf("external signer does not manage %s", account.Hex())
+}
+
+func (c *Clef) Address() common.Address { return c.addr }
+
+// clefTxArgs is the SendTxArgs object account_signTransaction expects.
+type clefTxArgs struct {
+	From                 common.MixedcaseAddress  `json:"from"`
+	To                   *common.MixedcaseAddress `json:"to"`
+	Gas                  hexutil.Uint64           `json:"gas"`
+	MaxFeePerGas         *hexutil.Big             `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexutil.Big             `json:"maxPriorityFeePerGas"`
+	Value                hexutil.Big              `json:"value"`
+	Nonce                hexutil.Uint64           `json:"nonce"`
+	Input                hexutil.Bytes            `json:"input"`
+	ChainID              *hexutil.Big             `json:"chainId"`
+}
+
+func (c *Clef) SignTx(ctx context.Context, tx *types.Transaction) (*types.Transaction, error) {
+	if tx.Type() != types.DynamicFeeTxType {
+		return nil, fmt.Errorf("external signer: unsupported tx type %d", tx.Type())
+	}
+	args := clefTxArgs{
+		From:                 common.NewMixedcaseAddress(c.addr),
+		Gas:                  hexutil.Uint64(tx.Gas()),
+		MaxFeePerGas:         (*hexutil.Big)(tx.GasFeeCap()),
+		MaxPriorityFeePerGas: (*hexutil.Big)(tx.GasTipCap()),
+		Value:                hexutil.Big(*tx.Value()),
+		Nonce:                hexutil.Uint64(tx.Nonce()),
+		Input:                tx.Data(),
+		ChainID:              (*hexutil.Big)(c.chainID),
+	}
+	if tx.To() != nil {
+		to := common.NewMixedcaseAddress(*tx.To())
+		args.To = &to
+	}
+
+	var res struct {
+		Raw hexutil.Bytes `json:"raw"`
+	}
+	if err := c.client.CallContext(ctx, &res, "account_signTransaction", args); err != nil {
+		return nil, fmt.Errorf("account_signTransaction: %w", err)
+	}
+	signed := new(types.Transaction)
+	if err := signed.UnmarshalBinary(res.Raw); err != nil {
+		return nil, fmt.Errorf("external signer returned an invalid transaction: %w", err)
+	}
+	if err := checkSigned(c.addr, tx, signed, c.chainID); err != nil {
+		return nil, fmt.Errorf("external signer: %w", err)
+	}
+	return signed, nil
+}
+
+// Close disconnects from the signer.
+func (c *Clef) Close() { c.client.Close() }
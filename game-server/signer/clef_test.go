@@ -0,0 +1,135 @@
+package signer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var testChainID = big.NewInt(11155111)
+
+// clefStub answers the account_ methods Clef serves, signing with key.
+type clefStub struct {
+	key *ecdsa.PrivateKey
+	// tamper makes the stub sign a different transaction than asked for.
+	tamper bool
+}
+
+func (s *clefStub) List() []common.Address {
+	return []common.Address{crypto.PubkeyToAddress(s.key.PublicKey)}
+}
+
+func (s *clefStub) SignTransaction(args clefTxArgs) (map[string]hexutil.Bytes, error) {
+	inner := &types.DynamicFeeTx{
+		ChainID:   (*big.Int)(args.ChainID),
+		Nonce:     uint64(args.Nonce),
+		GasTipCap: (*big.Int)(args.MaxPriorityFeePerGas),
+		GasFeeCap: (*big.Int)(args.MaxFeePerGas),
+		Gas:       uint64(args.Gas),
+		Value:     args.Value.ToInt(),
+		Data:      args.Input,
+	}
+	if args.To != nil {
+		to := args.To.Address()
+		inner.To = &to
+	}
+	if s.tamper {
+		inner.Nonce++
+	}
+	signed, err := types.SignNewTx(s.key, types.LatestSignerForChainID(inner.ChainID), inner)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := signed.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]hexutil.Bytes{"raw": raw}, nil
+}
+
+func startClef(t *testing.T, stub *clefStub) string {
+	t.Helper()
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", stub); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(server)
+	t.Cleanup(func() {
+		ts.Close()
+		server.Stop()
+	})
+	return ts.URL
+}
+
+func testTx() *types.Transaction {
+	to := common.HexToAddress("0x3726fef83444Ba54F925A5d2195f697234DfA30C")
+	return types.NewTx(&types.DynamicFeeTx{
+		ChainID:   testChainID,
+		Nonce:     7,
+		GasTipCap: big.NewInt(1e9),
+		GasFeeCap: big.NewInt(30e9),
+		Gas:       60000,
+		To:        &to,
+		Data:      []byte{0xa9, 0x05, 0x9c, 0xbb},
+	})
+}
+
+func TestClefSignTransaction(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	ctx := context.Background()
+
+	clef, err := DialClef(ctx, startClef(t, &clefStub{key: key}), addr, testChainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clef.Close()
+
+	tx := testTx()
+	signed, err := clef.SignTx(ctx, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(testChainID), signed)
+	if err != nil || from != addr {
+		t.Fatalf("sender %s (%v), want %s", from.Hex(), err, addr.Hex())
+	}
+	if signed.Nonce() != tx.Nonce() || signed.ChainId().Cmp(testChainID) != 0 {
+		t.Fatal("signed transaction differs from the request")
+	}
+}
+
+func TestClefRejectsTamperedTransaction(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	ctx := context.Background()
+
+	clef, err := DialClef(ctx, startClef(t, &clefStub{key: key, tamper: true}), addr, testChainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clef.Close()
+
+	if _, err := clef.SignTx(ctx, testTx()); err == nil || !strings.Contains(err.Error(), "different transaction") {
+		t.Fatalf("got %v, want the tampered transaction refused", err)
+	}
+}
+
+func TestClefUnknownAccount(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	other, _ := crypto.GenerateKey()
+
+	_, err := DialClef(context.Background(), startClef(t, &clefStub{key: key}), crypto.PubkeyToAddress(other.PublicKey), testChainID)
+	if err == nil {
+		t.Fatal("dialed a signer that does not manage the account")
+	}
+}
@@ -0,0 +1,38 @@
+package signer
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+)
+
+// OpenKeystore decrypts a go-ethereum keystore JSON file with the
+// passphrase stored in passwordFile.
+func OpenKeystore(path, passwordFile string, chainID *big.Int) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	passphrase, err := ReadSecret(passwordFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := keystore.DecryptKey(data, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt %s: %w", path, err)
+	}
+	return NewKey(key.PrivateKey, chainID), nil
+}
+
+// ReadSecret returns the first line of a passphrase or PIN file.
+func ReadSecret(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
@@ -0,0 +1,68 @@
+package signer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// writeKeystore stores a new key in a keystore under dir, encrypted with
+// passphrase, and returns its file.
+func writeKeystore(t *testing.T, dir, passphrase string) (string, common.Address) {
+	t.Helper()
+	priv, _ := crypto.GenerateKey()
+	ks := keystore.NewKeyStore(dir, keystore.LightScryptN, keystore.LightScryptP)
+	account, err := ks.ImportECDSA(priv, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return account.URL.Path, account.Address
+}
+
+func TestKeystoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path, addr := writeKeystore(t, dir, "correct horse")
+	passwordFile := filepath.Join(dir, "password")
+	if err := os.WriteFile(passwordFile, []byte("correct horse\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := OpenKeystore(path, passwordFile, testChainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Address() != addr {
+		t.Fatalf("address %s, want %s", key.Address().Hex(), addr.Hex())
+	}
+
+	signed, err := key.SignTx(context.Background(), testTx())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signed.ChainId().Cmp(testChainID) != 0 {
+		t.Fatalf("signed for chain %s, want %s", signed.ChainId(), testChainID)
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(testChainID), signed)
+	if err != nil || from != addr {
+		t.Fatalf("sender %s (%v), want %s", from.Hex(), err, addr.Hex())
+	}
+}
+
+func TestKeystoreWrongPassphrase(t *testing.T) {
+	dir := t.TempDir()
+	path, _ := writeKeystore(t, dir, "correct horse")
+	passwordFile := filepath.Join(dir, "password")
+	if err := os.WriteFile(passwordFile, []byte("battery staple\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenKeystore(path, passwordFile, testChainID); err == nil {
+		t.Fatal("decrypted with the wrong passphrase")
+	}
+}
@@ -0,0 +1,223 @@
+//go:build cgo
+
+package signer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/miekg/pkcs11"
+)
+
+// oidSecp256k1 is the curve the key object must be on.
+var oidSecp256k1 = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+
+// PKCS11Config names the module, token and key pair to sign with.
+type PKCS11Config struct {
+	Module     string // path of the PKCS#11 shared library
+	TokenLabel string
+	KeyLabel   string // CKA_LABEL of both the private and public key object
+	PIN        string
+}
+
+// PKCS11 signs on a hardware token or HSM through a PKCS#11 module. The
+// private key never leaves the device; the device returns a bare (r, s)
+// pair and the recovery id is worked out here.
+type PKCS11 struct {
+	mu      sync.Mutex // a PKCS#11 session handles one operation at a time
+	p       *pkcs11.Ctx
+	session pkcs11.SessionHandle
+	key     pkcs11.ObjectHandle
+	pub     []byte // uncompressed public key
+	addr    common.Address
+	signer  types.Signer
+}
+
+// OpenPKCS11 loads the module, logs in to the token and finds the key pair.
+func OpenPKCS11(c PKCS11Config, chainID *big.Int) (*PKCS11, error) {
+	p := pkcs11.New(c.Module)
+	if p == nil {
+		return nil, fmt.Errorf("cannot load PKCS#11 module %s", c.Module)
+	}
+	if err := p.Initialize(); err != nil {
+		p.Destroy()
+		return nil, fmt.Errorf("initialize %s: %w", c.Module, err)
+	}
+	s := &PKCS11{p: p, signer: types.LatestSignerForChainID(chainID)}
+	if err := s.open(c); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *PKCS11) open(c PKCS11Config) error {
+	slot, err := s.findSlot(c.TokenLabel)
+	if err != nil {
+		return err
+	}
+	if s.session, err = s.p.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION); err != nil {
+		return fmt.Errorf("open session: %w", err)
+	}
+	if err := s.p.Login(s.session, pkcs11.CKU_USER, c.PIN); err != nil {
+		return fmt.Errorf("login to token %q: %w", c.TokenLabel, err)
+	}
+
+	if s.key, err = s.findObject(pkcs11.CKO_PRIVATE_KEY, c.KeyLabel); err != nil {
+		return err
+	}
+	pubObj, err := s.findObject(pkcs11.CKO_PUBLIC_KEY, c.KeyLabel)
+	if err != nil {
+		return err
+	}
+	attrs, err := s.p.GetAttributeValue(s.session, pubObj, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+	})
+	if err != nil {
+		return fmt.Errorf("read public key %q: %w", c.KeyLabel, err)
+	}
+	var curve asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(attrs[0].Value, &curve); err != nil || !curve.Equal(oidSecp256k1) {
+		return fmt.Errorf("key %q is not a secp256k1 key", c.KeyLabel)
+	}
+	pub, err := ecPoint(attrs[1].Value)
+	if err != nil {
+		return fmt.Errorf("key %q: %w", c.KeyLabel, err)
+	}
+	s.pub = crypto.FromECDSAPub(pub)
+	s.addr = crypto.PubkeyToAddress(*pub)
+	return nil
+}
+
+func (s *PKCS11) findSlot(label string) (uint, error) {
+	slots, err := s.p.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("list slots: %w", err)
+	}
+	for _, slot := range slots {
+		info, err := s.p.GetTokenInfo(slot)
+		if err == nil && info.Label == label {
+			return slot, nil
+		}
+	}
+	return 0, fmt.Errorf("no token labelled %q", label)
+}
+
+func (s *PKCS11) findObject(class uint, label string) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_EC),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+	if err := s.p.FindObjectsInit(s.session, template); err != nil {
+		return 0, err
+	}
+	objs, _, err := s.p.FindObjects(s.session, 2)
+	if ferr := s.p.FindObjectsFinal(s.session); err == nil {
+		err = ferr
+	}
+	if err != nil {
+		return 0, err
+	}
+	kind := "private"
+	if class == pkcs11.CKO_PUBLIC_KEY {
+		kind = "public"
+	}
+	switch len(objs) {
+	case 0:
+		return 0, fmt.Errorf("no EC %s key labelled %q", kind, label)
+	case 1:
+		return objs[0], nil
+	default:
+		return 0, fmt.Errorf("more than one EC %s key labelled %q", kind, label)
+	}
+}
+
+// ecPoint decodes CKA_EC_POINT, which the standard wraps in a DER OCTET
+// STRING but some modules return bare.
+func ecPoint(v []byte) (*ecdsa.PublicKey, error) {
+	var inner []byte
+	if rest, err := asn1.Unmarshal(v, &inner); err == nil && len(rest) == 0 {
+		v = inner
+	}
+	return crypto.UnmarshalPubkey(v)
+}
+
+func (s *PKCS11) Address() common.Address { return s.addr }
+
+func (s *PKCS11) SignTx(_ context.Context, tx *types.Transaction) (*types.Transaction, error) {
+	sig, err := s.sign(s.signer.Hash(tx).Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return tx.WithSignature(s.signer, sig)
+}
+
+// sign returns a 65-byte [R || S || V] signature of hash.
+func (s *PKCS11) sign(hash []byte) ([]byte, error) {
+	s.mu.Lock()
+	rs, err := s.signRaw(hash)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return withRecoveryID(hash, rs, s.pub)
+}
+
+// withRecoveryID turns the bare (r, s) a device returns into the form
+// go-ethereum accepts: s in the lower half of the curve order and a
+// recovery id. The device does not say which of the two candidate points
+// it used, so both are tried against the known public key.
+func withRecoveryID(hash, rs, pub []byte) ([]byte, error) {
+	if len(rs) != 64 {
+		return nil, fmt.Errorf("PKCS#11 module returned a %d-byte signature", len(rs))
+	}
+	n := crypto.S256().Params().N
+	sv := new(big.Int).SetBytes(rs[32:])
+	if sv.Cmp(new(big.Int).Rsh(n, 1)) > 0 {
+		sv.Sub(n, sv)
+	}
+	sig := make([]byte, 65)
+	copy(sig, rs[:32])
+	sv.FillBytes(sig[32:64])
+
+	for v := byte(0); v < 2; v++ {
+		sig[64] = v
+		got, err := crypto.Ecrecover(hash, sig)
+		if err == nil && string(got) == string(pub) {
+			return sig, nil
+		}
+	}
+	return nil, errors.New("PKCS#11 signature does not recover to the token's public key")
+}
+
+func (s *PKCS11) signRaw(hash []byte) ([]byte, error) {
+	mech := []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)}
+	if err := s.p.SignInit(s.session, mech, s.key); err != nil {
+		return nil, fmt.Errorf("PKCS#11 sign init: %w", err)
+	}
+	sig, err := s.p.Sign(s.session, hash)
+	if err != nil {
+		return nil, fmt.Errorf("PKCS#11 sign: %w", err)
+	}
+	return sig, nil
+}
+
+// Close logs out and unloads the module.
+func (s *PKCS11) Close() {
+	if s.session != 0 {
+		s.p.Logout(s.session)
+		s.p.CloseSession(s.session)
+	}
+	s.p.Finalize()
+	s.p.Destroy()
+}
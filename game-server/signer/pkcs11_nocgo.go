@@ -0,0 +1,27 @@
+//go:build !cgo
+
+package signer
+
+import (
+	"errors"
+	"math/big"
+)
+
+// PKCS11Config names the module, token and key pair to sign with.
+type PKCS11Config struct {
+	Module     string
+	TokenLabel string
+	KeyLabel   string
+	PIN        string
+}
+
+// PKCS11 is unavailable without cgo.
+type PKCS11 struct{ Key }
+
+// OpenPKCS11 always fails: loading a PKCS#11 module needs cgo.
+func OpenPKCS11(PKCS11Config, *big.Int) (*PKCS11, error) {
+	return nil, errors.New("PKCS#11 support needs a cgo build")
+}
+
+// Close does nothing.
+func (s *PKCS11) Close() {}
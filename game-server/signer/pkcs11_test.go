@@ -0,0 +1,156 @@
+//go:build cgo
+
+package signer
+
+import (
+	"context"
+	"encoding/asn1"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/miekg/pkcs11"
+)
+
+// softHSMModule returns the SoftHSM library from $SOFTHSM2_MODULE or the
+// usual install paths, or "" when SoftHSM is not installed.
+func softHSMModule() string {
+	candidates := []string{
+		os.Getenv("SOFTHSM2_MODULE"),
+		"/usr/lib/softhsm/libsofthsm2.so",
+		"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+		"/usr/lib/aarch64-linux-gnu/softhsm/libsofthsm2.so",
+		"/usr/local/lib/softhsm/libsofthsm2.so",
+		"/opt/homebrew/lib/softhsm/libsofthsm2.so",
+	}
+	for _, path := range candidates {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// initSoftHSM creates a token in a throwaway SoftHSM store and generates a
+// secp256k1 key pair labelled key on it.
+func initSoftHSM(t *testing.T, module string, c PKCS11Config) {
+	t.Helper()
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "softhsm2.conf")
+	tokens := filepath.Join(dir, "tokens")
+	if err := os.Mkdir(tokens, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(conf, []byte("directories.tokendir = "+tokens+"\nobjectstore.backend = file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SOFTHSM2_CONF", conf)
+
+	p := pkcs11.New(module)
+	if p == nil {
+		t.Fatalf("cannot load %s", module)
+	}
+	defer p.Destroy()
+	if err := p.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Finalize()
+
+	slots, err := p.GetSlotList(false)
+	if err != nil || len(slots) == 0 {
+		t.Fatalf("no SoftHSM slot: %v", err)
+	}
+	const soPIN = "12345678"
+	if err := p.InitToken(slots[0], soPIN, c.TokenLabel); err != nil {
+		t.Fatal(err)
+	}
+	// SoftHSM moves the new token to another slot.
+	slots, err = p.GetSlotList(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var slot uint
+	found := false
+	for _, s := range slots {
+		if info, err := p.GetTokenInfo(s); err == nil && info.Label == c.TokenLabel {
+			slot, found = s, true
+		}
+	}
+	if !found {
+		t.Fatal("initialized token not found")
+	}
+
+	session, err := p.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.CloseSession(session)
+	if err := p.Login(session, pkcs11.CKU_SO, soPIN); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.InitPIN(session, c.PIN); err != nil {
+		t.Fatal(err)
+	}
+	p.Logout(session)
+	if err := p.Login(session, pkcs11.CKU_USER, c.PIN); err != nil {
+		t.Fatal(err)
+	}
+
+	curve, err := asn1.Marshal(oidSecp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = p.GenerateKeyPair(session,
+		[]*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_EC_KEY_PAIR_GEN, nil)},
+		[]*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+			pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, curve),
+			pkcs11.NewAttribute(pkcs11.CKA_LABEL, c.KeyLabel),
+		},
+		[]*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+			pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+			pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_LABEL, c.KeyLabel),
+		})
+	if err != nil {
+		t.Fatalf("generate secp256k1 key: %v", err)
+	}
+}
+
+func TestPKCS11SoftHSM(t *testing.T) {
+	module := softHSMModule()
+	if module == "" {
+		t.Skip("SoftHSM not installed; set SOFTHSM2_MODULE to its library to run")
+	}
+	c := PKCS11Config{Module: module, TokenLabel: "game-server-test", KeyLabel: "operator", PIN: "4321"}
+	initSoftHSM(t, module, c)
+
+	s, err := OpenPKCS11(c, testChainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Several signatures, so both recovery ids are likely to come up.
+	for i := 0; i < 8; i++ {
+		tx := testTx()
+		signed, err := s.SignTx(context.Background(), tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		from, err := types.Sender(types.LatestSignerForChainID(testChainID), signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if from != s.Address() {
+			t.Fatalf("recovered %s, key is %s", from.Hex(), s.Address().Hex())
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Package signer abstracts where the operator key lives. Every write path
+// in the server signs through a Signer, so switching from a raw key to a
+// keystore or an external signer is a configuration change.
+package signer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Signer signs transactions for a single account on a single chain.
+type Signer interface {
+	Address() common.Address
+	SignTx(ctx context.Context, tx *types.Transaction) (*types.Transaction, error)
+}
+
+// TransactOpts adapts s to the abigen bindings. ctx is used for every
+// signature made through the returned options.
+func TransactOpts(ctx context.Context, s Signer) *bind.TransactOpts {
+	return &bind.TransactOpts{
+		From:    s.Address(),
+		Context: ctx,
+		Signer: func(from common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			if from != s.Address() {
+				return nil, bind.ErrNotAuthorized
+			}
+			return s.SignTx(ctx, tx)
+		},
+	}
+}
+
+// Key signs with a private key held in memory.
+type Key struct {
+	key    *ecdsa.PrivateKey
+	addr   common.Address
+	signer types.Signer
+}
+
+// NewKey returns a Signer for key on chainID.
+func NewKey(key *ecdsa.PrivateKey, chainID *big.Int) *Key {
+	return &Key{
+		key:    key,
+		addr:   crypto.PubkeyToAddress(key.PublicKey),
+		signer: types.LatestSignerForChainID(chainID),
+	}
+}
+
+// FromHex parses a hex private key, with or without 0x.
+func FromHex(hexKey string, chainID *big.Int) (*Key, error) {
+	if hexKey == "" {
+		return nil, errors.New("no private key given")
+	}
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(hexKey, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	return NewKey(key, chainID), nil
+}
+
+func (k *Key) Address() common.Address { return k.addr }
+
+func (k *Key) SignTx(_ context.Context, tx *types.Transaction) (*types.Transaction, error) {
+	return types.SignTx(tx, k.signer, k.key)
+}
+
+// checkSigned verifies that a signature produced outside this process is
+// by want and covers exactly the transaction that was asked for.
+func checkSigned(want common.Address, unsigned, signed *types.Transaction, chainID *big.Int) error {
+	s := types.LatestSignerForChainID(chainID)
+	if s.Hash(signed) != s.Hash(unsigned) {
+		return errors.New("signed a different transaction")
+	}
+	from, err := types.Sender(s, signed)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	if from != want {
+		return fmt.Errorf("signed by %s, expected %s", from.Hex(), want.Hex())
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+// Package siwe parses and verifies Sign-In with Ethereum (EIP-4361)
+// messages.
+package siwe
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const header = " wants you to sign in with your Ethereum account:"
+
+var (
+	ErrMalformed    = errors.New("malformed SIWE message")
+	ErrDomain       = errors.New("SIWE message is for another domain")
+	ErrChain        = errors.New("SIWE message is for another chain")
+	ErrNonce        = errors.New("unknown or used SIWE nonce")
+	ErrExpired      = errors.New("SIWE message expired or not yet valid")
+	ErrBadSignature = errors.New("SIWE signature does not match the address")
+)
+
+// Message is a parsed EIP-4361 message.
+type Message struct {
+	Domain         string
+	Address        common.Address
+	Statement      string
+	URI            string
+	Version        string
+	ChainID        uint64
+	Nonce          string
+	IssuedAt       time.Time
+	ExpirationTime *time.Time
+	NotBefore      *time.Time
+	RequestID      string
+	Resources      []string
+}
+
+// Parse reads a message in the EIP-4361 text format. The address must be
+// in its EIP-55 checksummed form, as the standard requires.
+func Parse(text string) (*Message, error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if len(lines) < 2 || !strings.HasSuffix(lines[0], header) {
+		return nil, fmt.Errorf("%w: missing header", ErrMalformed)
+	}
+	m := &Message{Domain: strings.TrimSuffix(lines[0], header)}
+	if m.Domain == "" {
+		return nil, fmt.Errorf("%w: empty domain", ErrMalformed)
+	}
+	if !common.IsHexAddress(lines[1]) || common.HexToAddress(lines[1]).Hex() != lines[1] {
+		return nil, fmt.Errorf("%w: address must be EIP-55 checksummed", ErrMalformed)
+	}
+	m.Address = common.HexToAddress(lines[1])
+
+	i := 2
+	for i < len(lines) && lines[i] == "" {
+		i++
+	}
+	if i < len(lines) && !strings.HasPrefix(lines[i], "URI: ") {
+		m.Statement = lines[i]
+		i++
+		for i < len(lines) && lines[i] == "" {
+			i++
+		}
+	}
+
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if line == "" {
+			continue
+		}
+		if line == "Resources:" {
+			for i++; i < len(lines) && strings.HasPrefix(lines[i], "- "); i++ {
+				m.Resources = append(m.Resources, strings.TrimPrefix(lines[i], "- "))
+			}
+			i--
+			continue
+		}
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			return nil, fmt.Errorf("%w: unexpected line %q", ErrMalformed, line)
+		}
+		var err error
+		switch key {
+		case "URI":
+			m.URI = value
+		case "Version":
+			m.Version = value
+		case "Chain ID":
+			m.ChainID, err = strconv.ParseUint(value, 10, 64)
+		case "Nonce":
+			m.Nonce = value
+		case "Issued At":
+			m.IssuedAt, err = time.Parse(time.RFC3339, value)
+		case "Expiration Time":
+			m.ExpirationTime, err = parseTime(value)
+		case "Not Before":
+			m.NotBefore, err = parseTime(value)
+		case "Request ID":
+			m.RequestID = value
+		default:
+			return nil, fmt.Errorf("%w: unknown field %q", ErrMalformed, key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrMalformed, key, err)
+		}
+	}
+
+	if m.URI == "" || m.Version != "1" || m.ChainID == 0 || len(m.Nonce) < 8 || m.IssuedAt.IsZero() {
+		return nil, fmt.Errorf("%w: URI, Version 1, Chain ID, Nonce and Issued At are required", ErrMalformed)
+	}
+	return m, nil
+}
+
+func parseTime(v string) (*time.Time, error) {
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Valid checks the message's time window at now.
+func (m *Message) Valid(now time.Time) bool {
+	if m.ExpirationTime != nil && !now.Before(*m.ExpirationTime) {
+		return false
+	}
+	if m.NotBefore != nil && now.Before(*m.NotBefore) {
+		return false
+	}
+	return true
+}
+
+// Verifier checks messages for one domain and chain, and hands out the
+// single-use nonces they must carry.
+type Verifier struct {
+	Domain  string
+	ChainID uint64
+	// NonceTTL is how long an issued nonce can be used.
+	NonceTTL time.Duration
+	// MaxAge bounds how long after Issued At a message without an
+	// Expiration Time is accepted.
+	MaxAge time.Duration
+
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+// NewVerifier returns a verifier for domain and chainID.
+func NewVerifier(domain string, chainID uint64) *Verifier {
+	return &Verifier{
+		Domain:   domain,
+		ChainID:  chainID,
+		NonceTTL: 10 * time.Minute,
+		MaxAge:   10 * time.Minute,
+		nonces:   make(map[string]time.Time),
+	}
+}
+
+// Nonce issues a fresh nonce.
+func (v *Verifier) Nonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	n := hex.EncodeToString(b)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	now := time.Now()
+	for k, exp := range v.nonces {
+		if now.After(exp) {
+			delete(v.nonces, k)
+		}
+	}
+	v.nonces[n] = now.Add(v.NonceTTL)
+	return n
+}
+
+// Verify parses text, checks it against the verifier's domain and chain,
+// consumes its nonce and checks that signature (a personal_sign signature
+// of text) was made by the message's address.
+func (v *Verifier) Verify(text string, signature []byte, now time.Time) (*Message, error) {
+	m, err := Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if m.Domain != v.Domain {
+		return nil, ErrDomain
+	}
+	if m.ChainID != v.ChainID {
+		return nil, ErrChain
+	}
+	if !m.Valid(now) || (m.ExpirationTime == nil && now.Sub(m.IssuedAt) > v.MaxAge) {
+		return nil, ErrExpired
+	}
+
+	if len(signature) != crypto.SignatureLength {
+		return nil, ErrBadSignature
+	}
+	sig := append([]byte(nil), signature...)
+	if sig[64] >= 27 {
+		sig[64] -= 27
+	}
+	pub, err := crypto.SigToPub(accounts.TextHash([]byte(text)), sig)
+	if err != nil || crypto.PubkeyToAddress(*pub) != m.Address {
+		return nil, ErrBadSignature
+	}
+
+	// Consume the nonce last so a bad signature cannot burn someone
+	// else's nonce.
+	v.mu.Lock()
+	exp, ok := v.nonces[m.Nonce]
+	delete(v.nonces, m.Nonce)
+	v.mu.Unlock()
+	if !ok || now.After(exp) {
+		return nil, ErrNonce
+	}
+	return m, nil
+}
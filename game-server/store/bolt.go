@@ -0,0 +1,367 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketMeta      = []byte("meta")
+	bucketPlays     = []byte("plays")
+	bucketPlayIndex = []byte("play_index")
+	bucketStreaks   = []byte("streaks")
+	bucketBonuses   = []byte("bonuses")
+	bucketCursors   = []byte("cursors")
+	bucketNonces    = []byte("intent_nonces")
+	bucketMints     = []byte("mint_audit")
+	bucketIssuance  = []byte("issuance")
+
+	keySchemaVersion = []byte("schema_version")
+)
+
+// migrations bring the database from version i to i+1. Append only; never
+// edit a migration that has shipped.
+var migrations = []func(tx *bolt.Tx) error{
+	// 1: initial layout.
+	func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketPlays, bucketPlayIndex, bucketStreaks, bucketBonuses, bucketCursors} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// 2: per-player play-intent nonces.
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketNonces)
+		return err
+	},
+	// 3: admin mint audit log.
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketMints)
+		return err
+	},
+	// 4: token issuance for the supply breakdown.
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketIssuance)
+		return err
+	},
+}
+
+// Bolt is a Store backed by a single bbolt file.
+type Bolt struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens or creates the database at path and runs any pending
+// migrations.
+func OpenBolt(path string) (*Bolt, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	s := &Bolt{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Bolt) migrate() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(bucketMeta)
+		if err != nil {
+			return err
+		}
+		var version int
+		if v := meta.Get(keySchemaVersion); v != nil {
+			version, err = strconv.Atoi(string(v))
+			if err != nil {
+				return fmt.Errorf("bad schema version %q", v)
+			}
+		}
+		if version > len(migrations) {
+			return fmt.Errorf("database schema v%d is newer than this server (v%d)", version, len(migrations))
+		}
+		for ; version < len(migrations); version++ {
+			if err := migrations[version](tx); err != nil {
+				return fmt.Errorf("migration %d: %w", version+1, err)
+			}
+		}
+		return meta.Put(keySchemaVersion, []byte(strconv.Itoa(version)))
+	})
+}
+
+func (s *Bolt) Close() error {
+	return s.db.Close()
+}
+
+func (s *Bolt) AddPlay(p Play) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		plays := tx.Bucket(bucketPlays)
+		index := tx.Bucket(bucketPlayIndex)
+
+		hash := common.HexToHash(p.TxHash)
+		if seq := index.Get(hash.Bytes()); seq != nil {
+			return putJSON(plays, seq, p)
+		}
+		n, err := plays.NextSequence()
+		if err != nil {
+			return err
+		}
+		seq := uint64Key(n)
+		if err := index.Put(hash.Bytes(), seq); err != nil {
+			return err
+		}
+		return putJSON(plays, seq, p)
+	})
+}
+
+func (s *Bolt) UpdatePlay(hash common.Hash, fn func(*Play)) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		plays := tx.Bucket(bucketPlays)
+		seq := tx.Bucket(bucketPlayIndex).Get(hash.Bytes())
+		if seq == nil {
+			return ErrNotFound
+		}
+		var p Play
+		if err := json.Unmarshal(plays.Get(seq), &p); err != nil {
+			return err
+		}
+		fn(&p)
+		return putJSON(plays, seq, p)
+	})
+}
+
+func (s *Bolt) RekeyPlay(from, to common.Hash) error {
+	if from == to {
+		return nil
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		plays := tx.Bucket(bucketPlays)
+		index := tx.Bucket(bucketPlayIndex)
+		seq := index.Get(from.Bytes())
+		if seq == nil {
+			return ErrNotFound
+		}
+		seq = append([]byte(nil), seq...)
+		var p Play
+		if err := json.Unmarshal(plays.Get(seq), &p); err != nil {
+			return err
+		}
+		p.TxHash = to.Hex()
+		if err := index.Delete(from.Bytes()); err != nil {
+			return err
+		}
+		if err := index.Put(to.Bytes(), seq); err != nil {
+			return err
+		}
+		return putJSON(plays, seq, p)
+	})
+}
+
+func (s *Bolt) Plays() ([]Play, error) {
+	var out []Play
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketPlays).ForEach(func(_, v []byte) error {
+			var p Play
+			if err := json.Unmarshal(v, &p); err != nil {
+				return err
+			}
+			out = append(out, p)
+			return nil
+		})
+	})
+	return out, err
+}
+
+func (s *Bolt) Streaks() (map[string]int, error) {
+	out := make(map[string]int)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketStreaks).ForEach(func(k, v []byte) error {
+			n, err := strconv.Atoi(string(v))
+			if err != nil {
+				return err
+			}
+			out[string(k)] = n
+			return nil
+		})
+	})
+	return out, err
+}
+
+func (s *Bolt) SetStreak(player string, n int) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketStreaks)
+		if n == 0 {
+			return b.Delete([]byte(player))
+		}
+		return b.Put([]byte(player), []byte(strconv.Itoa(n)))
+	})
+}
+
+func (s *Bolt) PutBonus(b Bonus) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketBonuses), []byte(b.Trigger), b)
+	})
+}
+
+func (s *Bolt) Bonus(trigger string) (Bonus, error) {
+	var b Bonus
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketBonuses).Get([]byte(trigger))
+		if v == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(v, &b)
+	})
+	return b, err
+}
+
+func (s *Bolt) Bonuses() ([]Bonus, error) {
+	var out []Bonus
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketBonuses).ForEach(func(_, v []byte) error {
+			var b Bonus
+			if err := json.Unmarshal(v, &b); err != nil {
+				return err
+			}
+			out = append(out, b)
+			return nil
+		})
+	})
+	return out, err
+}
+
+func (s *Bolt) Cursor(name string) (uint64, error) {
+	var n uint64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(bucketCursors).Get([]byte(name)); v != nil {
+			n = binary.BigEndian.Uint64(v)
+		}
+		return nil
+	})
+	return n, err
+}
+
+func (s *Bolt) SetCursor(name string, block uint64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketCursors).Put([]byte(name), uint64Key(block))
+	})
+}
+
+func (s *Bolt) Nonce(player common.Address) (uint64, error) {
+	var n uint64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(bucketNonces).Get(player.Bytes()); v != nil {
+			n = binary.BigEndian.Uint64(v)
+		}
+		return nil
+	})
+	return n, err
+}
+
+func (s *Bolt) UseNonce(player common.Address, nonce uint64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketNonces)
+		var next uint64
+		if v := b.Get(player.Bytes()); v != nil {
+			next = binary.BigEndian.Uint64(v)
+		}
+		if nonce != next {
+			return ErrNonceUsed
+		}
+		return b.Put(player.Bytes(), uint64Key(next+1))
+	})
+}
+
+func (s *Bolt) AddMint(m Mint) (uint64, error) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketMints)
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		m.ID = id
+		return putJSON(b, uint64Key(id), m)
+	})
+	return m.ID, err
+}
+
+func (s *Bolt) UpdateMint(m Mint) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketMints)
+		if b.Get(uint64Key(m.ID)) == nil {
+			return ErrNotFound
+		}
+		return putJSON(b, uint64Key(m.ID), m)
+	})
+}
+
+func (s *Bolt) Mints() ([]Mint, error) {
+	var out []Mint
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketMints).ForEach(func(_, v []byte) error {
+			var m Mint
+			if err := json.Unmarshal(v, &m); err != nil {
+				return err
+			}
+			out = append(out, m)
+			return nil
+		})
+	})
+	return out, err
+}
+
+func (s *Bolt) PutIssuance(i Issuance) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketIssuance), issuanceKey(common.HexToHash(i.TxHash), i.LogIndex), i)
+	})
+}
+
+func (s *Bolt) DeleteIssuance(hash common.Hash, index uint) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketIssuance).Delete(issuanceKey(hash, index))
+	})
+}
+
+func (s *Bolt) Issuances() ([]Issuance, error) {
+	var out []Issuance
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketIssuance).ForEach(func(_, v []byte) error {
+			var i Issuance
+			if err := json.Unmarshal(v, &i); err != nil {
+				return err
+			}
+			out = append(out, i)
+			return nil
+		})
+	})
+	return out, err
+}
+
+// issuanceKey identifies a log by its transaction and log index.
+func issuanceKey(hash common.Hash, index uint) []byte {
+	return append(hash.Bytes(), uint64Key(uint64(index))...)
+}
+
+func putJSON(b *bolt.Bucket, key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
+
+func uint64Key(n uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, n)
+	return key
+}
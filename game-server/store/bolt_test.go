@@ -0,0 +1,211 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	bolt "go.etcd.io/bbolt"
+)
+
+func openTestBolt(t *testing.T, path string) *Bolt {
+	t.Helper()
+	s, err := OpenBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func schemaVersion(t *testing.T, s *Bolt) string {
+	t.Helper()
+	var v string
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		v = string(tx.Bucket(bucketMeta).Get(keySchemaVersion))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestMigrateEmpty(t *testing.T) {
+	s := openTestBolt(t, filepath.Join(t.TempDir(), "game.db"))
+	if got, want := schemaVersion(t, s), strconv.Itoa(len(migrations)); got != want {
+		t.Fatalf("schema v%s, want v%s", got, want)
+	}
+	// Every bucket a migration creates is usable.
+	if _, err := s.AddMint(Mint{To: "0x1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UseNonce(common.Address{1}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutIssuance(Issuance{TxHash: common.Hash{1}.Hex(), Kind: IssueAdmin}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateFromV1(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.db")
+	hash := common.Hash{1}
+
+	// A database as the first release left it.
+	db, err := bolt.Open(path, 0o600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucket(bucketMeta)
+		if err != nil {
+			return err
+		}
+		if err := migrations[0](tx); err != nil {
+			return err
+		}
+		if err := tx.Bucket(bucketStreaks).Put([]byte("0xabc"), []byte("2")); err != nil {
+			return err
+		}
+		return meta.Put(keySchemaVersion, []byte("1"))
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := openTestBolt(t, path)
+	if got, want := schemaVersion(t, s), strconv.Itoa(len(migrations)); got != want {
+		t.Fatalf("schema v%s, want v%s", got, want)
+	}
+	streaks, err := s.Streaks()
+	if err != nil || streaks["0xabc"] != 2 {
+		t.Fatalf("streaks %v (%v) after migrating, want the v1 streak kept", streaks, err)
+	}
+	if err := s.AddPlay(Play{TxHash: hash.Hex()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddMint(Mint{To: "0x1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UseNonce(common.Address{1}, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.db")
+	s, err := OpenBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketMeta).Put(keySchemaVersion, []byte(strconv.Itoa(len(migrations)+1)))
+	})
+	s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := OpenBolt(path); err == nil {
+		s.Close()
+		t.Fatal("opened a database from a newer server")
+	}
+}
+
+func TestUseNonceRejectsReplay(t *testing.T) {
+	s := openTestBolt(t, filepath.Join(t.TempDir(), "game.db"))
+	player := common.Address{1}
+
+	if err := s.UseNonce(player, 1); !errors.Is(err, ErrNonceUsed) {
+		t.Fatalf("nonce 1 before 0: got %v, want ErrNonceUsed", err)
+	}
+	if err := s.UseNonce(player, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UseNonce(player, 0); !errors.Is(err, ErrNonceUsed) {
+		t.Fatalf("replayed nonce 0: got %v, want ErrNonceUsed", err)
+	}
+	if n, err := s.Nonce(player); err != nil || n != 1 {
+		t.Fatalf("next nonce %d (%v), want 1", n, err)
+	}
+	// Nonces are per player.
+	if err := s.UseNonce(common.Address{2}, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRekeyPlay(t *testing.T) {
+	s := openTestBolt(t, filepath.Join(t.TempDir(), "game.db"))
+	from, to := common.Hash{1}, common.Hash{2}
+	if err := s.AddPlay(Play{TxHash: from.Hex(), Guess: 4}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.RekeyPlay(from, to); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdatePlay(from, func(*Play) {}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("old hash: got %v, want ErrNotFound", err)
+	}
+	if err := s.UpdatePlay(to, func(p *Play) { p.Result = "win" }); err != nil {
+		t.Fatal(err)
+	}
+	plays, err := s.Plays()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plays) != 1 || plays[0].TxHash != to.Hex() || plays[0].Guess != 4 || plays[0].Result != "win" {
+		t.Fatalf("plays %+v, want the one play under the new hash", plays)
+	}
+	if err := s.RekeyPlay(common.Hash{3}, to); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unknown hash: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.db")
+	s, err := OpenBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.Cursor("events"); err != nil || n != 0 {
+		t.Fatalf("unset cursor %d (%v), want 0", n, err)
+	}
+	for name, block := range map[string]uint64{"events": 1 << 40, "supply": 7} {
+		if err := s.SetCursor(name, block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+
+	// Cursors survive a restart and stay apart.
+	s = openTestBolt(t, path)
+	for name, want := range map[string]uint64{"events": 1 << 40, "supply": 7} {
+		if n, err := s.Cursor(name); err != nil || n != want {
+			t.Fatalf("cursor %s = %d (%v), want %d", name, n, err, want)
+		}
+	}
+}
+
+func TestUpdateMint(t *testing.T) {
+	s := openTestBolt(t, filepath.Join(t.TempDir(), "game.db"))
+	id, err := s.AddMint(Mint{To: "0x1", Status: MintPending})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateMint(Mint{ID: id, To: "0x1", Status: MintSent, TxHash: "0xaa"}); err != nil {
+		t.Fatal(err)
+	}
+	mints, err := s.Mints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mints) != 1 || mints[0].Status != MintSent || mints[0].TxHash != "0xaa" {
+		t.Fatalf("mints %+v, want the one entry updated", mints)
+	}
+	if err := s.UpdateMint(Mint{ID: id + 1}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unknown mint: got %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,165 @@
+// Package store persists game history and the server's own state so that a
+// restart does not lose plays, streaks, payouts or the event cursor.
+package store
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	// ErrNotFound is returned when a record does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrNonceUsed is returned by UseNonce for a nonce that is not the
+	// player's next one.
+	ErrNonceUsed = errors.New("nonce already used or out of order")
+)
+
+// Play is one play submitted through the server and, once its events are
+// seen, its outcome.
+type Play struct {
+	Address string `json:"address"`
+	// Player is the address that signed the play intent, when there is one.
+	Player      string    `json:"player,omitempty"`
+	Guess       int       `json:"guess"`
+	Winning     int       `json:"winning"`
+	Result      string    `json:"result"`
+	Prize       string    `json:"prize"`
+	TxHash      string    `json:"txHash"`
+	BlockNumber uint64    `json:"blockNumber"`
+	BlockTime   time.Time `json:"blockTime"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// Bonus statuses. A bonus moves owed -> sent -> paid; a sent payout that
+// reverts goes back to owed until it runs out of attempts and becomes dead.
+const (
+	BonusOwed      = "owed"
+	BonusSent      = "sent"
+	BonusPaid      = "paid"
+	BonusDead      = "dead"
+	BonusCancelled = "cancelled"
+)
+
+// Bonus is a streak bonus paid or owed to a player. Trigger is the hash of
+// the Win transaction that completed the streak.
+type Bonus struct {
+	Trigger string `json:"trigger"`
+	Player  string `json:"player"`
+	Amount  string `json:"amount"`
+	TxHash  string `json:"txHash"`
+	RawTx   string `json:"rawTx,omitempty"`
+	// PrevTxHashes are the transactions TxHash replaced at the same nonce,
+	// any of which may still be the one that gets mined.
+	PrevTxHashes []string `json:"prevTxHashes,omitempty"`
+	// Accepted is set once a node has taken one of the transactions, after
+	// which their nonce is spent even if none of them is mined.
+	Accepted  bool      `json:"accepted,omitempty"`
+	Status    string    `json:"status"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"lastError,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// TxHashes returns every transaction the payout was broadcast as.
+func (b Bonus) TxHashes() []string {
+	if b.TxHash == "" {
+		return b.PrevTxHashes
+	}
+	return append([]string{b.TxHash}, b.PrevTxHashes...)
+}
+
+// Admin mint outcomes. A mint is logged as pending before anything is
+// signed, so one that reached the chain always has an entry.
+const (
+	MintPending = "pending"
+	MintSent    = "sent"
+	MintFailed  = "failed"
+	MintRefused = "refused"
+)
+
+// Mint is one entry of the admin mint audit log. Every request is logged,
+// including refused and failed ones.
+type Mint struct {
+	ID        uint64    `json:"id"`
+	Caller    string    `json:"caller"`
+	Remote    string    `json:"remote"`
+	To        string    `json:"to"`
+	Amount    string    `json:"amount"`
+	Reason    string    `json:"reason"`
+	TxHash    string    `json:"txHash,omitempty"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Kinds of token issuance in the supply breakdown.
+const (
+	IssueInitial = "initial"
+	IssueAdmin   = "admin"
+	IssueBonus   = "bonus"
+	IssueOther   = "other"
+)
+
+// Issuance is one Transfer from the zero address seen on-chain, classified
+// by where it came from.
+type Issuance struct {
+	TxHash   string `json:"txHash"`
+	LogIndex uint   `json:"logIndex"`
+	Block    uint64 `json:"block"`
+	To       string `json:"to"`
+	Amount   string `json:"amount"`
+	Kind     string `json:"kind"`
+}
+
+// Store is the persistence backend used by the server.
+type Store interface {
+	// AddPlay records a new play keyed by its transaction hash.
+	AddPlay(p Play) error
+	// UpdatePlay applies fn to the play sent in tx. It returns ErrNotFound
+	// if there is none.
+	UpdatePlay(tx common.Hash, fn func(*Play)) error
+	// RekeyPlay moves a play to the hash of the transaction that replaced
+	// the one it was recorded under.
+	RekeyPlay(from, to common.Hash) error
+	// Plays returns every play in submission order.
+	Plays() ([]Play, error)
+
+	// Streaks returns the current win streak of every player.
+	Streaks() (map[string]int, error)
+	SetStreak(player string, n int) error
+
+	// PutBonus inserts or replaces the bonus with the same Trigger.
+	PutBonus(b Bonus) error
+	Bonus(trigger string) (Bonus, error)
+	Bonuses() ([]Bonus, error)
+
+	// Nonce returns the next unused play-intent nonce of player.
+	Nonce(player common.Address) (uint64, error)
+	// UseNonce consumes nonce if it is the player's next one, and returns
+	// ErrNonceUsed otherwise.
+	UseNonce(player common.Address, nonce uint64) error
+
+	// AddMint appends to the mint audit log and returns the entry's ID.
+	AddMint(m Mint) (uint64, error)
+	// UpdateMint replaces the audit entry with m's ID. It returns
+	// ErrNotFound if there is none.
+	UpdateMint(m Mint) error
+	// Mints returns the audit log, oldest first.
+	Mints() ([]Mint, error)
+
+	// PutIssuance inserts or replaces the issuance logged at tx and
+	// LogIndex; DeleteIssuance forgets one that was reorged out.
+	PutIssuance(i Issuance) error
+	DeleteIssuance(tx common.Hash, index uint) error
+	Issuances() ([]Issuance, error)
+
+	// Cursor returns the last processed block for name, or 0.
+	Cursor(name string) (uint64, error)
+	SetCursor(name string, block uint64) error
+
+	Close() error
+}
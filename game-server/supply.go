@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gin-gonic/gin"
+
+	"github.com/exccrr/solidity-token-go-integration/game-server/store"
+	"github.com/exccrr/solidity-token-go-integration/game-server/token"
+)
+
+// supplyCursor names the stored block up to which token issuance has been
+// recorded.
+const supplyCursor = "supply"
+
+// supplyUnconfirmed is the breakdown key for supply minted after the last
+// block the event pipeline confirmed, whose mints are not recorded yet.
+const supplyUnconfirmed = "unconfirmed"
+
+var tokenStats *tokenInfo
+
+// tokenInfo is what GET /token serves. The name, symbol and decimals cannot
+// change and are read once; the supply and owner are re-read at every new
+// block.
+type tokenInfo struct {
+	caller *token.TokenCaller
+	name   string
+
+	mu       sync.Mutex
+	snapshot *supplySnapshot
+	// tracked is set once every mint up to the event cursor is recorded;
+	// until then there is no breakdown.
+	tracked bool
+	// confirmed is the newest block whose mints are recorded.
+	confirmed uint64
+}
+
+type supplySnapshot struct {
+	block       uint64
+	totalSupply *big.Int
+	owner       common.Address
+	// breakdown splits the supply as of confirmedBlock; what was minted
+	// since is under supplyUnconfirmed.
+	breakdown      map[string]*big.Int
+	confirmedBlock uint64
+}
+
+func loadTokenInfo(ctx context.Context) (*tokenInfo, error) {
+	caller, err := token.NewTokenCaller(cfg.TokenAddress, client)
+	if err != nil {
+		return nil, err
+	}
+	name, err := caller.Name(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return nil, fmt.Errorf("read name: %w", err)
+	}
+	return &tokenInfo{caller: caller, name: name}, nil
+}
+
+func (t *tokenInfo) current() *supplySnapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.snapshot
+}
+
+func (t *tokenInfo) isTracked() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.tracked
+}
+
+// setConfirmed records that the mints up to block are in the database.
+func (t *tokenInfo) setConfirmed(block uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.confirmed = max(t.confirmed, block)
+}
+
+// refresh reads the supply and owner as of block. The breakdown is worked
+// out at the confirmed block, since later mints are not recorded yet, and
+// the supply added after it is reported as unconfirmed. A refresh that
+// finishes after one for a later block is dropped.
+func (t *tokenInfo) refresh(ctx context.Context, block uint64) error {
+	opts := &bind.CallOpts{Context: ctx, BlockNumber: new(big.Int).SetUint64(block)}
+	supply, err := t.caller.TotalSupply(opts)
+	if err != nil {
+		return fmt.Errorf("read total supply: %w", err)
+	}
+	owner, err := t.caller.Owner(opts)
+	if err != nil {
+		return fmt.Errorf("read owner: %w", err)
+	}
+	snap := &supplySnapshot{block: block, totalSupply: supply, owner: owner}
+
+	t.mu.Lock()
+	tracked, confirmed := t.tracked, min(t.confirmed, block)
+	t.mu.Unlock()
+	if tracked {
+		confirmedSupply := supply
+		if confirmed < block {
+			opts.BlockNumber = new(big.Int).SetUint64(confirmed)
+			if confirmedSupply, err = t.caller.TotalSupply(opts); err != nil {
+				return fmt.Errorf("read confirmed total supply: %w", err)
+			}
+		}
+		if snap.breakdown, err = supplyBreakdown(confirmedSupply, confirmed); err != nil {
+			return err
+		}
+		snap.breakdown[supplyUnconfirmed] = new(big.Int).Sub(supply, confirmedSupply)
+		snap.confirmedBlock = confirmed
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.snapshot == nil || t.snapshot.block <= block {
+		t.snapshot = snap
+	}
+	return nil
+}
+
+func refreshToken(ctx context.Context, block uint64) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if err := tokenStats.refresh(ctx, block); err != nil {
+		log.Println("Token supply refresh failed:", err)
+	}
+}
+
+// supplyBreakdown splits total into the recorded issuance up to block.
+// Whatever the records do not explain, such as mints by another owner or
+// from before token_deploy_block, is counted as other.
+func supplyBreakdown(total *big.Int, block uint64) (map[string]*big.Int, error) {
+	issued, err := db.Issuances()
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]*big.Int{
+		store.IssueInitial: new(big.Int),
+		store.IssueAdmin:   new(big.Int),
+		store.IssueBonus:   new(big.Int),
+		store.IssueOther:   new(big.Int).Set(total),
+	}
+	for _, i := range issued {
+		if i.Block > block || i.Kind == store.IssueOther {
+			continue
+		}
+		if n, ok := new(big.Int).SetString(i.Amount, 10); ok {
+			out[i.Kind].Add(out[i.Kind], n)
+			out[store.IssueOther].Sub(out[store.IssueOther], n)
+		}
+	}
+	return out, nil
+}
+
+// trackIssuance records the mints up to block to, starting after the last
+// run's cursor, so the live Transfer handler can take over from there. It
+// runs in the background; the cursor is saved after every chunk so a restart
+// resumes where it stopped, and a failed chunk is retried with backoff.
+// Only a fresh local chain is scanned from genesis; elsewhere a deploy block
+// is needed.
+func trackIssuance(ctx context.Context, to, chunk uint64) {
+	from, err := db.Cursor(supplyCursor)
+	if err != nil {
+		log.Println("Supply breakdown unavailable:", err)
+		return
+	}
+	if from == 0 {
+		from = cfg.TokenDeployBlock
+		if from == 0 {
+			from = cfg.DeployBlock
+		}
+		if from == 0 && !cfg.StartsEmpty() {
+			log.Println("Supply breakdown disabled: set token_deploy_block or deploy_block")
+			return
+		}
+	} else {
+		from++
+	}
+	if from <= to {
+		log.Println("Recording token issuance in blocks", from, "to", to)
+	}
+
+	backoff := time.Second
+	for start := from; start <= to; {
+		end := start + chunk - 1
+		if end > to {
+			end = to
+		}
+		if err := recordIssuanceRange(ctx, start, end); err != nil {
+			log.Println("Recording token issuance failed:", err, "- retrying in", backoff)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, time.Minute)
+			continue
+		}
+		backoff = time.Second
+		if err := db.SetCursor(supplyCursor, end); err != nil {
+			log.Println("Failed to save supply cursor:", err)
+		}
+		start = end + 1
+	}
+
+	tokenStats.mu.Lock()
+	tokenStats.tracked = true
+	tokenStats.mu.Unlock()
+	log.Println("Token issuance recorded up to block", to)
+}
+
+func recordIssuanceRange(ctx context.Context, start, end uint64) error {
+	mints, err := tokenInstance.FilterTransfer(&bind.FilterOpts{Start: start, End: &end, Context: ctx}, []common.Address{{}}, nil)
+	if err != nil {
+		return fmt.Errorf("Transfer %d-%d: %w", start, end, err)
+	}
+	defer mints.Close()
+	for mints.Next() {
+		if err := recordIssuance(ctx, mints.Event); err != nil {
+			return err
+		}
+	}
+	return mints.Error()
+}
+
+// followSupply re-reads the supply and owner at every new block, from a
+// head subscription where the node offers one and by polling otherwise.
+func followSupply(ctx context.Context, pollInterval time.Duration) {
+	heads := make(chan *types.Header, 16)
+	sub, err := client.SubscribeNewHead(ctx, heads)
+	if err != nil {
+		if !errors.Is(err, rpc.ErrNotificationsUnsupported) {
+			log.Println("Head subscription failed:", err, "- polling for token supply")
+		}
+		pollSupply(ctx, pollInterval)
+		return
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-sub.Err():
+			log.Println("Head subscription lost:", err, "- polling for token supply")
+			pollSupply(ctx, pollInterval)
+			return
+		case head := <-heads:
+			refreshToken(ctx, head.Number.Uint64())
+		}
+	}
+}
+
+func pollSupply(ctx context.Context, pollInterval time.Duration) {
+	var last uint64
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		head, err := client.HeaderByNumber(ctx, nil)
+		if err != nil {
+			log.Println("Token supply poll failed:", err)
+		} else if n := head.Number.Uint64(); n != last {
+			last = n
+			refreshToken(ctx, n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// recordIssuance stores a Transfer from the zero address with its kind.
+func recordIssuance(ctx context.Context, ev *token.TokenTransfer) error {
+	kind, err := issuanceKind(ctx, ev.Raw.TxHash)
+	if err != nil {
+		return err
+	}
+	return db.PutIssuance(store.Issuance{
+		TxHash:   ev.Raw.TxHash.Hex(),
+		LogIndex: ev.Raw.Index,
+		Block:    ev.Raw.BlockNumber,
+		To:       ev.To.Hex(),
+		Amount:   ev.Value.String(),
+		Kind:     kind,
+	})
+}
+
+// issuanceKind tells a bonus or admin mint this server sent, by its
+// transaction hash, from the initial supply minted in the Token's creation
+// transaction and from anything else.
+func issuanceKind(ctx context.Context, hash common.Hash) (string, error) {
+	bonuses, err := db.Bonuses()
+	if err != nil {
+		return "", err
+	}
+	for _, b := range bonuses {
+		if slices.Contains(b.TxHashes(), hash.Hex()) {
+			return store.IssueBonus, nil
+		}
+	}
+	mints, err := db.Mints()
+	if err != nil {
+		return "", err
+	}
+	for _, m := range mints {
+		if m.TxHash == hash.Hex() {
+			return store.IssueAdmin, nil
+		}
+	}
+	tx, _, err := client.TransactionByHash(ctx, hash)
+	if err != nil {
+		return "", fmt.Errorf("read mint tx %s: %w", hash.Hex(), err)
+	}
+	if tx.To() == nil {
+		return store.IssueInitial, nil
+	}
+	return store.IssueOther, nil
+}
+
+func tokenHandler(c *gin.Context) {
+	snap := tokenStats.current()
+	if snap == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "token supply not loaded yet"})
+		return
+	}
+	resp := gin.H{
+		"address":     cfg.TokenAddress.Hex(),
+		"addressUrl":  cfg.Link("address", cfg.TokenAddress.Hex()),
+		"name":        tokenStats.name,
+		"symbol":      units.Symbol,
+		"decimals":    units.Decimals,
+		"owner":       snap.owner.Hex(),
+		"totalSupply": units.Value(snap.totalSupply),
+		"block":       snap.block,
+	}
+	if snap.breakdown != nil {
+		supply := gin.H{}
+		for kind, n := range snap.breakdown {
+			supply[kind] = units.Value(n)
+		}
+		resp["supply"] = supply
+		resp["supplyBlock"] = snap.confirmedBlock
+	}
+	c.JSON(http.StatusOK, resp)
+}
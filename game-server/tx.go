@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/exccrr/solidity-token-go-integration/game-server/config"
+	"github.com/exccrr/solidity-token-go-integration/game-server/signer"
+	"github.com/exccrr/solidity-token-go-integration/game-server/txmgr"
+)
+
+// send signs and broadcasts one transaction from the server key. It is the
+// only place that builds TransactOpts, so every write path shares the
+// signer, the nonce manager and the fee policy.
+func send(ctx context.Context, op txmgr.Operation, fn func(*bind.TransactOpts) (*types.Transaction, error)) (*types.Transaction, error) {
+	tx, err := signOnly(ctx, op, fn)
+	if err != nil {
+		return nil, err
+	}
+	if err := broadcast(ctx, tx); err != nil {
+		unsent(tx, err)
+		return nil, err
+	}
+	return tx, nil
+}
+
+// signOnly is send for a transaction the caller broadcasts itself. Its
+// nonce stays reserved until the caller commits it once broadcast, or
+// releases it if the transaction is thrown away.
+func signOnly(ctx context.Context, op txmgr.Operation, fn func(*bind.TransactOpts) (*types.Transaction, error)) (*types.Transaction, error) {
+	return reserve(ctx, op, func(auth *bind.TransactOpts) (*types.Transaction, error) {
+		auth.NoSend = true
+		return fn(auth)
+	})
+}
+
+// broadcast sends a transaction made with signOnly and commits its nonce
+// once the node has it.
+func broadcast(ctx context.Context, tx *types.Transaction) error {
+	err := client.SendTransaction(ctx, tx)
+	if err != nil && strings.Contains(strings.ToLower(err.Error()), "already known") {
+		err = nil
+	}
+	if err == nil {
+		nonces.Commit(tx.Nonce())
+	}
+	return err
+}
+
+// unsent gives back the nonce of a transaction broadcast failed for. A
+// node that answered with an error did not take it, so the nonce is reused
+// at once; after a timeout or a lost connection it may have, and the node
+// is asked before the nonce is handed out again.
+func unsent(tx *types.Transaction, err error) {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && !txmgr.IsNonceError(err) {
+		nonces.Release(tx.Nonce())
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if rerr := nonces.Abandon(ctx, tx.Nonce()); rerr != nil {
+		log.Println("Nonce resync failed:", rerr)
+	}
+}
+
+// reserve runs fn with a reserved nonce and gives the nonce back if fn
+// fails. fn only signs; nothing has been broadcast when it returns.
+func reserve(ctx context.Context, op txmgr.Operation, fn func(*bind.TransactOpts) (*types.Transaction, error)) (*types.Transaction, error) {
+	auth := signer.TransactOpts(ctx, txSigner)
+	if err := feePolicy.Apply(ctx, client, op, auth); err != nil {
+		return nil, err
+	}
+
+	nonce, err := nonces.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+	auth.Nonce = new(big.Int).SetUint64(nonce)
+
+	tx, err := fn(auth)
+	if err != nil {
+		nonces.Release(nonce)
+		if txmgr.IsNonceError(err) {
+			if rerr := nonces.Resync(ctx); rerr != nil {
+				log.Println("Nonce resync failed:", rerr)
+			}
+		}
+		return nil, err
+	}
+	return tx, nil
+}
+
+// waitTx waits for a transaction sent with send, re-broadcasting it with
+// bumped fees while it is stuck. A transaction that never makes it into a
+// block may have been dropped, so the nonce manager is resynced to hand its
+// nonce out again.
+func waitTx(ctx context.Context, tx *types.Transaction) (*types.Receipt, error) {
+	receipt, err := txWaiter.WaitReplaceable(ctx, tx, cfg.TxRebroadcastAfter, bumpTx)
+	if err != nil && receipt == nil {
+		if rerr := nonces.Resync(context.Background()); rerr != nil {
+			log.Println("Nonce resync failed:", rerr)
+		}
+	}
+	return receipt, err
+}
+
+// bumpTx re-signs prev at the same nonce with higher fees and broadcasts it.
+func bumpTx(ctx context.Context, prev *types.Transaction) (*types.Transaction, error) {
+	replacement, err := signBump(ctx, prev)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.SendTransaction(ctx, replacement); err != nil {
+		return nil, err
+	}
+	log.Println("Re-broadcast", prev.Hash().Hex(), "as", replacement.Hash().Hex(), "fee cap", replacement.GasFeeCap())
+	return replacement, nil
+}
+
+// signBump re-signs prev at the same nonce with bumped fees.
+func signBump(ctx context.Context, prev *types.Transaction) (*types.Transaction, error) {
+	feeCap, tip, err := feePolicy.Bump(prev)
+	if err != nil {
+		return nil, err
+	}
+	return txSigner.SignTx(ctx, types.NewTx(&types.DynamicFeeTx{
+		ChainID:   new(big.Int).SetUint64(cfg.ChainID),
+		Nonce:     prev.Nonce(),
+		GasTipCap: tip,
+		GasFeeCap: feeCap,
+		Gas:       prev.Gas(),
+		To:        prev.To(),
+		Value:     prev.Value(),
+		Data:      prev.Data(),
+	}))
+}
+
+// newFeePolicy builds the fee policy from the configured caps and limits.
+func newFeePolicy(cfg *config.Config) *txmgr.FeePolicy {
+	policy := &txmgr.FeePolicy{
+		MaxFeeCap:   cfg.MaxFee,
+		MaxTipCap:   cfg.MaxPriorityFee,
+		MaxBaseFee:  cfg.MaxBaseFee,
+		BumpPercent: cfg.FeeBumpPercent,
+		GasLimits:   map[txmgr.Operation]uint64{},
+	}
+	for op, limit := range cfg.GasLimits {
+		policy.GasLimits[txmgr.Operation(op)] = limit
+	}
+	return policy
+}
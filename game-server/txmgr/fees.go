@@ -0,0 +1,135 @@
+package txmgr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Operation names a kind of transaction the server sends.
+type Operation string
+
+const (
+	OpApprove  Operation = "approve"
+	OpPlay     Operation = "play"
+	OpMint     Operation = "mint"
+	OpWithdraw Operation = "withdraw"
+)
+
+var (
+	// ErrBaseFeeTooHigh is returned when the network is too busy to send.
+	ErrBaseFeeTooHigh = errors.New("base fee above configured limit")
+	// ErrFeeCapReached is returned by Bump when the fee cap leaves no room
+	// for a replacement.
+	ErrFeeCapReached = errors.New("fee cap reached")
+)
+
+// FeeBackend is what FeePolicy needs from the node.
+type FeeBackend interface {
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	SuggestGasTipCap(ctx context.Context) (*big.Int, error)
+}
+
+// FeePolicy caps what the server is willing to pay for its transactions.
+// Nil caps mean no limit; a zero gas limit falls back to estimation.
+type FeePolicy struct {
+	MaxFeeCap   *big.Int
+	MaxTipCap   *big.Int
+	MaxBaseFee  *big.Int
+	GasLimits   map[Operation]uint64
+	BumpPercent uint64
+}
+
+// Apply fills in the EIP-1559 fee fields and gas limit for op.
+func (p *FeePolicy) Apply(ctx context.Context, backend FeeBackend, op Operation, auth *bind.TransactOpts) error {
+	feeCap, tip, err := p.Suggest(ctx, backend)
+	if err != nil {
+		return err
+	}
+	auth.GasTipCap = tip
+	auth.GasFeeCap = feeCap
+	auth.GasPrice = nil
+	auth.GasLimit = p.GasLimits[op]
+	return nil
+}
+
+// Suggest returns the fee cap and tip for a transaction sent now, within
+// the policy's caps.
+func (p *FeePolicy) Suggest(ctx context.Context, backend FeeBackend) (feeCap, tip *big.Int, err error) {
+	head, err := backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetch head: %w", err)
+	}
+	if head.BaseFee == nil {
+		return nil, nil, errors.New("chain does not support EIP-1559")
+	}
+	if p.MaxBaseFee != nil && head.BaseFee.Cmp(p.MaxBaseFee) > 0 {
+		return nil, nil, fmt.Errorf("%w: %s > %s wei", ErrBaseFeeTooHigh, head.BaseFee, p.MaxBaseFee)
+	}
+
+	tip, err = backend.SuggestGasTipCap(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("suggest tip: %w", err)
+	}
+	tip = capped(tip, p.MaxTipCap)
+
+	// Same headroom bind uses: survive a few full blocks of base fee growth.
+	feeCap = new(big.Int).Add(new(big.Int).Mul(head.BaseFee, big.NewInt(2)), tip)
+	feeCap = capped(feeCap, p.MaxFeeCap)
+	if feeCap.Cmp(head.BaseFee) < 0 {
+		return nil, nil, fmt.Errorf("%w: fee cap %s below base fee %s", ErrBaseFeeTooHigh, feeCap, head.BaseFee)
+	}
+	if tip.Cmp(feeCap) > 0 {
+		tip = new(big.Int).Set(feeCap)
+	}
+	return feeCap, tip, nil
+}
+
+// Bump returns the fee cap and tip for a replacement of tx. Nodes only accept
+// a replacement that raises both by at least 10%.
+func (p *FeePolicy) Bump(tx *types.Transaction) (feeCap, tip *big.Int, err error) {
+	percent := p.BumpPercent
+	if percent < 10 {
+		percent = 10
+	}
+	feeCap = bumped(tx.GasFeeCap(), percent)
+	tip = bumped(tx.GasTipCap(), percent)
+
+	if p.MaxFeeCap != nil && feeCap.Cmp(p.MaxFeeCap) > 0 {
+		return nil, nil, ErrFeeCapReached
+	}
+	if p.MaxTipCap != nil && tip.Cmp(p.MaxTipCap) > 0 {
+		return nil, nil, ErrFeeCapReached
+	}
+	return feeCap, tip, nil
+}
+
+func bumped(v *big.Int, percent uint64) *big.Int {
+	out := new(big.Int).Mul(v, new(big.Int).SetUint64(100+percent))
+	out.Add(out, big.NewInt(99))
+	return out.Div(out, big.NewInt(100))
+}
+
+func capped(v, limit *big.Int) *big.Int {
+	if limit != nil && v.Cmp(limit) > 0 {
+		return new(big.Int).Set(limit)
+	}
+	return v
+}
+
+// ParseGwei parses a decimal gwei amount such as "1.5" into wei.
+func ParseGwei(s string) (*big.Int, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok || r.Sign() < 0 {
+		return nil, fmt.Errorf("invalid gwei amount %q", s)
+	}
+	r.Mul(r, new(big.Rat).SetInt64(1e9))
+	if !r.IsInt() {
+		return nil, fmt.Errorf("gwei amount %q is finer than 1 wei", s)
+	}
+	return new(big.Int).Set(r.Num()), nil
+}
@@ -0,0 +1,162 @@
+package txmgr
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// NonceSource reports the next nonce the node expects for an account.
+type NonceSource interface {
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+}
+
+// NonceManager hands out nonces for a single account. Every code path that
+// signs with the account must go through the same manager.
+//
+// A nonce returned by Next must be passed to exactly one of Commit (the
+// transaction was broadcast), Release (it was not) or Abandon (nobody
+// knows). Released nonces are
+// reused before new ones are allocated, so an aborted send does not leave a
+// gap that blocks later transactions.
+type NonceManager struct {
+	mu       sync.Mutex
+	source   NonceSource
+	account  common.Address
+	synced   bool
+	next     uint64
+	released []uint64
+	inflight map[uint64]struct{}
+}
+
+// NewNonceManager returns a manager for account. It syncs with the node
+// lazily on the first call to Next.
+func NewNonceManager(source NonceSource, account common.Address) *NonceManager {
+	return &NonceManager{
+		source:   source,
+		account:  account,
+		inflight: make(map[uint64]struct{}),
+	}
+}
+
+// Account returns the address the manager allocates nonces for.
+func (m *NonceManager) Account() common.Address {
+	return m.account
+}
+
+// Next reserves the lowest available nonce.
+func (m *NonceManager) Next(ctx context.Context) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.synced {
+		if err := m.resyncLocked(ctx); err != nil {
+			return 0, err
+		}
+	}
+
+	var nonce uint64
+	if len(m.released) > 0 {
+		nonce = m.released[0]
+		m.released = m.released[1:]
+	} else {
+		nonce = m.next
+		m.next++
+	}
+	m.inflight[nonce] = struct{}{}
+	return nonce, nil
+}
+
+// Commit marks nonce as used by a broadcast transaction.
+func (m *NonceManager) Commit(nonce uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.inflight, nonce)
+}
+
+// Release returns an unused nonce so the next caller fills the gap.
+func (m *NonceManager) Release(nonce uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.inflight[nonce]; !ok {
+		return
+	}
+	delete(m.inflight, nonce)
+	if nonce >= m.next {
+		return
+	}
+	m.released = append(m.released, nonce)
+	sort.Slice(m.released, func(i, j int) bool { return m.released[i] < m.released[j] })
+}
+
+// Abandon gives up a reserved nonce whose transaction may or may not have
+// reached the node, as after a send that timed out. The manager resyncs
+// with the node, which then decides: the nonce is reused only if the node's
+// pending nonce has not moved past it. If the node cannot be asked, the next
+// call to Next tries again before handing anything out.
+func (m *NonceManager) Abandon(ctx context.Context, nonce uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.inflight[nonce]; !ok {
+		return nil
+	}
+	delete(m.inflight, nonce)
+	if err := m.resyncLocked(ctx); err != nil {
+		m.synced = false
+		return err
+	}
+	return nil
+}
+
+// Resync realigns the manager with the node's pending nonce. Nonces between
+// the node's view and our own that are not reserved by an in-flight send are
+// treated as gaps left by dropped transactions and handed out again.
+func (m *NonceManager) Resync(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.resyncLocked(ctx)
+}
+
+func (m *NonceManager) resyncLocked(ctx context.Context) error {
+	pending, err := m.source.PendingNonceAt(ctx, m.account)
+	if err != nil {
+		return err
+	}
+
+	next := pending
+	for n := range m.inflight {
+		if n >= next {
+			next = n + 1
+		}
+	}
+
+	m.released = m.released[:0]
+	for n := pending; n < next; n++ {
+		if _, ok := m.inflight[n]; !ok {
+			m.released = append(m.released, n)
+		}
+	}
+	m.next = next
+	m.synced = true
+	return nil
+}
+
+// IsNonceError reports whether err means the nonce we used is out of step
+// with the node.
+func IsNonceError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"nonce too low", "nonce too high", "replacement transaction underpriced", "already known"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package txmgr
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// fakeNode reports a fixed pending nonce, or err.
+type fakeNode struct {
+	pending uint64
+	calls   int
+	err     error
+}
+
+func (f *fakeNode) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	f.calls++
+	return f.pending, f.err
+}
+
+func next(t *testing.T, m *NonceManager) uint64 {
+	t.Helper()
+	n, err := m.Next(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestNonceManagerSyncsOnce(t *testing.T) {
+	node := &fakeNode{pending: 7}
+	m := NewNonceManager(node, common.Address{})
+	for want := uint64(7); want < 10; want++ {
+		if got := next(t, m); got != want {
+			t.Fatalf("got nonce %d, want %d", got, want)
+		}
+		m.Commit(want)
+	}
+	if node.calls != 1 {
+		t.Fatalf("asked the node %d times, want once", node.calls)
+	}
+}
+
+func TestNonceManagerReusesReleasedNonce(t *testing.T) {
+	m := NewNonceManager(&fakeNode{}, common.Address{})
+	a, b, c := next(t, m), next(t, m), next(t, m)
+	m.Commit(a)
+	m.Release(b)
+	m.Commit(c)
+
+	if got := next(t, m); got != b {
+		t.Fatalf("got nonce %d, want the released %d", got, b)
+	}
+	if got := next(t, m); got != 3 {
+		t.Fatalf("got nonce %d, want 3", got)
+	}
+}
+
+func TestNonceManagerIgnoresStrayRelease(t *testing.T) {
+	m := NewNonceManager(&fakeNode{}, common.Address{})
+	n := next(t, m)
+	m.Commit(n)
+	m.Release(n) // already broadcast: must not be handed out again
+	m.Release(42)
+	if got := next(t, m); got != 1 {
+		t.Fatalf("got nonce %d, want 1", got)
+	}
+}
+
+func TestNonceManagerResyncFillsGaps(t *testing.T) {
+	node := &fakeNode{}
+	m := NewNonceManager(node, common.Address{})
+	for i := 0; i < 5; i++ {
+		next(t, m)
+	}
+	// 0 and 1 were mined, 2 and 4 were dropped by the node, 3 is still
+	// being signed.
+	m.Commit(0)
+	m.Commit(1)
+	m.Commit(2)
+	m.Commit(4)
+	node.pending = 2
+	if err := m.Resync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []uint64{2, 4, 5} {
+		if got := next(t, m); got != want {
+			t.Fatalf("got nonce %d, want %d", got, want)
+		}
+	}
+}
+
+func TestNonceManagerResyncMovesForward(t *testing.T) {
+	node := &fakeNode{}
+	m := NewNonceManager(node, common.Address{})
+	m.Release(next(t, m))
+
+	// Another process sent with the same key.
+	node.pending = 10
+	if err := m.Resync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := next(t, m); got != 10 {
+		t.Fatalf("got nonce %d, want 10", got)
+	}
+}
+
+func TestNonceManagerAbandon(t *testing.T) {
+	node := &fakeNode{}
+	m := NewNonceManager(node, common.Address{})
+	a, b := next(t, m), next(t, m)
+
+	// The node took a despite the error, but not b.
+	node.pending = 1
+	if err := m.Abandon(context.Background(), a); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Abandon(context.Background(), b); err != nil {
+		t.Fatal(err)
+	}
+	if got := next(t, m); got != b {
+		t.Fatalf("got nonce %d, want %d back and %d kept spent", got, b, a)
+	}
+}
+
+func TestNonceManagerAbandonWithoutNode(t *testing.T) {
+	node := &fakeNode{}
+	m := NewNonceManager(node, common.Address{})
+	n := next(t, m)
+
+	node.err = errors.New("connection refused")
+	if err := m.Abandon(context.Background(), n); err == nil {
+		t.Fatal("abandoned without asking the node")
+	}
+	if _, err := m.Next(context.Background()); err == nil {
+		t.Fatal("handed out a nonce before the node could be asked")
+	}
+
+	// The node took it after all.
+	node.err, node.pending = nil, 1
+	if got := next(t, m); got != 1 {
+		t.Fatalf("got nonce %d, want 1", got)
+	}
+}
+
+func TestIsNonceError(t *testing.T) {
+	for _, msg := range []string{"nonce too low", "Nonce too high: next 5", "replacement transaction underpriced", "already known"} {
+		if !IsNonceError(errors.New(msg)) {
+			t.Errorf("%q not recognised as a nonce error", msg)
+		}
+	}
+	if IsNonceError(nil) || IsNonceError(errors.New("insufficient funds for gas")) {
+		t.Error("unrelated error recognised as a nonce error")
+	}
+}
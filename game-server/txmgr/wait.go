@@ -0,0 +1,179 @@
+// Package txmgr tracks transactions sent by the server from broadcast to
+// confirmation.
+package txmgr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ErrReverted is returned by Wait when the transaction was mined but failed.
+var ErrReverted = errors.New("transaction reverted")
+
+// Backend is the subset of ethclient.Client needed to follow a transaction.
+type Backend interface {
+	bind.DeployBackend
+	BlockNumber(ctx context.Context) (uint64, error)
+}
+
+// Waiter blocks until a transaction has been mined and buried under the
+// configured number of blocks. If a reorg moves it to another block in the
+// meantime, the count starts again there.
+type Waiter struct {
+	backend       Backend
+	confirmations uint64
+	timeout       time.Duration
+	pollInterval  time.Duration
+}
+
+// NewWaiter returns a Waiter. A confirmation depth of 1 means the receipt is
+// accepted as soon as the transaction is included in a block.
+func NewWaiter(backend Backend, confirmations uint64, timeout time.Duration) *Waiter {
+	if confirmations == 0 {
+		confirmations = 1
+	}
+	return &Waiter{
+		backend:       backend,
+		confirmations: confirmations,
+		timeout:       timeout,
+		pollInterval:  time.Second,
+	}
+}
+
+// Wait returns the receipt of tx once it has enough confirmations. A mined
+// but failed transaction yields its receipt together with ErrReverted.
+func (w *Waiter) Wait(ctx context.Context, tx *types.Transaction) (*types.Receipt, error) {
+	return w.WaitReplaceable(ctx, tx, 0, nil)
+}
+
+// Replacer re-broadcasts prev at the same nonce, typically with higher fees,
+// and returns the replacement.
+type Replacer func(ctx context.Context, prev *types.Transaction) (*types.Transaction, error)
+
+// WaitReplaceable is like Wait, but calls replace whenever the latest
+// broadcast has been pending for longer than stuckAfter. Whichever of the
+// broadcasts gets mined is followed to confirmation; its receipt carries the
+// hash that actually landed.
+func (w *Waiter) WaitReplaceable(ctx context.Context, tx *types.Transaction, stuckAfter time.Duration, replace Replacer) (*types.Receipt, error) {
+	if w.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.timeout)
+		defer cancel()
+	}
+
+	mined, receipt, err := w.waitMined(ctx, tx, stuckAfter, replace)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if err := w.waitDepth(ctx, receipt); err != nil {
+			return receipt, err
+		}
+		// A reorg may have moved the transaction to another block, or back
+		// to the mempool, while we were waiting; then the count starts
+		// again from wherever it is mined now.
+		fresh, err := w.backend.TransactionReceipt(ctx, mined.Hash())
+		if err == nil && fresh.BlockHash == receipt.BlockHash {
+			receipt = fresh
+			break
+		}
+		if mined, receipt, err = w.waitMined(ctx, mined, stuckAfter, replace); err != nil {
+			return nil, err
+		}
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return receipt, ErrReverted
+	}
+	return receipt, nil
+}
+
+// waitDepth waits until the block of receipt has enough confirmations.
+func (w *Waiter) waitDepth(ctx context.Context, receipt *types.Receipt) error {
+	target := receipt.BlockNumber.Uint64() + w.confirmations - 1
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+	for {
+		head, err := w.backend.BlockNumber(ctx)
+		if err == nil && head >= target {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("confirm %s: %w", receipt.TxHash.Hex(), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// waitMined returns whichever of tx and its replacements is mined first,
+// with its receipt.
+func (w *Waiter) waitMined(ctx context.Context, tx *types.Transaction, stuckAfter time.Duration, replace Replacer) (*types.Transaction, *types.Receipt, error) {
+	sent := []*types.Transaction{tx}
+	lastBroadcast := time.Now()
+
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+	for {
+		for _, candidate := range sent {
+			receipt, err := w.backend.TransactionReceipt(ctx, candidate.Hash())
+			if err == nil && receipt.BlockNumber != nil {
+				return candidate, receipt, nil
+			}
+		}
+
+		if replace != nil && stuckAfter > 0 && time.Since(lastBroadcast) >= stuckAfter {
+			next, err := replace(ctx, sent[len(sent)-1])
+			switch {
+			case err == nil:
+				sent = append(sent, next)
+				lastBroadcast = time.Now()
+			case errors.Is(err, ErrFeeCapReached):
+				replace = nil
+			default:
+				// Most likely one of the earlier broadcasts was just mined;
+				// the next poll will tell.
+				lastBroadcast = time.Now()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, fmt.Errorf("wait for %s: %w", tx.Hash().Hex(), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// Summary is the JSON view of a receipt returned by the API.
+type Summary struct {
+	Hash              string `json:"hash"`
+	Status            string `json:"status"`
+	BlockNumber       uint64 `json:"blockNumber"`
+	GasUsed           uint64 `json:"gasUsed"`
+	EffectiveGasPrice string `json:"effectiveGasPrice"`
+}
+
+// Summarize converts a receipt into a Summary.
+func Summarize(receipt *types.Receipt) Summary {
+	status := "success"
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		status = "reverted"
+	}
+	price := receipt.EffectiveGasPrice
+	if price == nil {
+		price = new(big.Int)
+	}
+	return Summary{
+		Hash:              receipt.TxHash.Hex(),
+		Status:            status,
+		BlockNumber:       receipt.BlockNumber.Uint64(),
+		GasUsed:           receipt.GasUsed,
+		EffectiveGasPrice: price.String(),
+	}
+}
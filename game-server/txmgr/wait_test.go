@@ -0,0 +1,118 @@
+package txmgr
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// fakeChain mines one block per call and serves a single receipt, which
+// onHead can move.
+type fakeChain struct {
+	mu      sync.Mutex
+	head    uint64
+	receipt *types.Receipt
+	// onHead, if set, runs at every new head.
+	onHead func(c *fakeChain)
+}
+
+func (c *fakeChain) tickLocked() {
+	c.head++
+	if c.onHead != nil {
+		c.onHead(c)
+	}
+}
+
+func (c *fakeChain) BlockNumber(ctx context.Context) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tickLocked()
+	return c.head, nil
+}
+
+func (c *fakeChain) TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tickLocked()
+	if c.receipt == nil || c.receipt.TxHash != hash {
+		return nil, ethereum.NotFound
+	}
+	r := *c.receipt
+	return &r, nil
+}
+
+func (c *fakeChain) CodeAt(ctx context.Context, account common.Address, block *big.Int) ([]byte, error) {
+	return nil, nil
+}
+
+func (c *fakeChain) mine(hash common.Hash, block uint64, salt byte) {
+	c.receipt = &types.Receipt{
+		TxHash:      hash,
+		Status:      types.ReceiptStatusSuccessful,
+		BlockNumber: new(big.Int).SetUint64(block),
+		BlockHash:   common.Hash{salt, byte(block)},
+	}
+}
+
+func TestWaiterRestartsAfterReorg(t *testing.T) {
+	tx := types.NewTx(&types.LegacyTx{Nonce: 1})
+	chain := &fakeChain{head: 9}
+	chain.mine(tx.Hash(), 10, 0)
+	reorged := false
+	chain.onHead = func(c *fakeChain) {
+		// Just as block 10 gets its third confirmation, a reorg moves the
+		// transaction to block 12 of another branch.
+		if c.head == 12 && !reorged {
+			reorged = true
+			c.mine(tx.Hash(), 12, 1)
+		}
+	}
+
+	w := NewWaiter(chain, 3, time.Minute)
+	w.pollInterval = time.Millisecond
+	receipt, err := w.Wait(context.Background(), tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.BlockNumber.Uint64() != 12 || receipt.BlockHash != (common.Hash{1, 12}) {
+		t.Fatalf("got the receipt from block %d, want the one from the new branch", receipt.BlockNumber)
+	}
+	if chain.head < 14 {
+		t.Fatalf("returned at head %d, before block 12 had three confirmations", chain.head)
+	}
+}
+
+func TestWaiterWaitsForReorgedOutTx(t *testing.T) {
+	tx := types.NewTx(&types.LegacyTx{Nonce: 1})
+	chain := &fakeChain{head: 9}
+	chain.mine(tx.Hash(), 10, 0)
+	chain.onHead = func(c *fakeChain) {
+		switch c.head {
+		case 12:
+			// Dropped back to the mempool by a reorg...
+			c.receipt = nil
+		case 15:
+			// ...and mined again later.
+			c.mine(tx.Hash(), 15, 1)
+		}
+	}
+
+	w := NewWaiter(chain, 3, time.Minute)
+	w.pollInterval = time.Millisecond
+	receipt, err := w.Wait(context.Background(), tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.BlockNumber.Uint64() != 15 {
+		t.Fatalf("got the receipt from block %d, want 15", receipt.BlockNumber)
+	}
+	if chain.head < 17 {
+		t.Fatalf("returned at head %d, before block 15 had three confirmations", chain.head)
+	}
+}
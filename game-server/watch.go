@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/exccrr/solidity-token-go-integration/game-server/events"
+	"github.com/exccrr/solidity-token-go-integration/game-server/game"
+	"github.com/exccrr/solidity-token-go-integration/game-server/token"
+)
+
+// newEventRouter wires the Game and Token events to their handlers.
+func newEventRouter() (*events.Router, error) {
+	gameAddr := cfg.GameAddress
+	tokenAddr := cfg.TokenAddress
+
+	router := events.NewRouter()
+	if err := router.AddContract("Game", gameAddr, game.GameMetaData); err != nil {
+		return nil, err
+	}
+	if err := router.AddContract("Token", tokenAddr, token.TokenMetaData); err != nil {
+		return nil, err
+	}
+
+	if err := events.On(router, gameAddr, "BetPlaced", gameInstance.ParseBetPlaced, onBetPlaced); err != nil {
+		return nil, err
+	}
+	if err := events.On(router, gameAddr, "Win", gameInstance.ParseWin, onWin); err != nil {
+		return nil, err
+	}
+	if err := events.On(router, gameAddr, "Loss", gameInstance.ParseLoss, onLoss); err != nil {
+		return nil, err
+	}
+	if err := events.On(router, tokenAddr, "Transfer", tokenInstance.ParseTransfer, onTransfer); err != nil {
+		return nil, err
+	}
+
+	if err := events.OnRemoved(router, gameAddr, "BetPlaced", gameInstance.ParseBetPlaced, onBetPlacedRemoved); err != nil {
+		return nil, err
+	}
+	if err := events.OnRemoved(router, gameAddr, "Win", gameInstance.ParseWin, onWinRemoved); err != nil {
+		return nil, err
+	}
+	if err := events.OnRemoved(router, gameAddr, "Loss", gameInstance.ParseLoss, onLossRemoved); err != nil {
+		return nil, err
+	}
+	if err := events.OnRemoved(router, tokenAddr, "Transfer", tokenInstance.ParseTransfer, onTransferRemoved); err != nil {
+		return nil, err
+	}
+	return router, nil
+}
+
+// eventCursor names the stored resume point of the event pipeline.
+const eventCursor = "events"
+
+// watchGameEvents feeds contract logs to the router for the lifetime of the
+// server, reconnecting whenever the subscription drops. Logs only reach the
+// router once they are confirmations blocks deep; logs reorged out after
+// that are dispatched again with Removed set. Processing resumes after the
+// stored cursor, so events emitted while the server was down are replayed.
+func watchGameEvents(router *events.Router, cursor, confirmations uint64, pollInterval time.Duration, chunkSize uint64) {
+	ctx := context.Background()
+
+	if cursor == 0 {
+		head, err := client.HeaderByNumber(ctx, nil)
+		if err != nil {
+			log.Println("Event watcher disabled:", err)
+			return
+		}
+		cursor = head.Number.Uint64()
+	}
+
+	// Mints up to the cursor are recorded in the background, later ones by
+	// onTransfer.
+	tokenStats.setConfirmed(cursor)
+	go trackIssuance(ctx, cursor, chunkSize)
+	go followSupply(ctx, pollInterval)
+
+	confirmer := events.NewConfirmer(client, router.Addresses(), confirmations, cursor, func(vLog types.Log) error {
+		if vLog.Removed {
+			log.Println("Rolling back", router.Name(vLog), "in tx", vLog.TxHash.Hex())
+		} else {
+			log.Println("Event", router.Name(vLog), "in tx", vLog.TxHash.Hex())
+		}
+		return router.Dispatch(vLog)
+	})
+
+	watcher := events.NewWatcher(client, router.Addresses(), cursor, confirmer.Add)
+	watcher.PollInterval = pollInterval
+	watcher.ChunkSize = chunkSize
+	confirmer.Fetched = watcher.Cursor
+
+	// OnAdvance runs once the released logs have been dispatched. The
+	// confirmer never releases past the watcher, but the resume point is
+	// capped by it too so a restart never skips logs nobody fetched.
+	confirmer.OnAdvance = func(released uint64) {
+		resume := min(released, watcher.Cursor())
+		if err := db.SetCursor(eventCursor, resume); err != nil {
+			log.Println("Failed to save event cursor:", err)
+		}
+		if tokenStats.isTracked() {
+			if err := db.SetCursor(supplyCursor, resume); err != nil {
+				log.Println("Failed to save supply cursor:", err)
+			}
+		}
+		tokenStats.setConfirmed(released)
+	}
+
+	go confirmer.Run(ctx, pollInterval)
+	if err := watcher.Run(ctx); err != nil {
+		log.Println("Event watcher stopped:", err)
+	}
+}
+
+func onBetPlaced(ev *game.GameBetPlaced) error {
+	history.ResolveBet(ev.Raw.TxHash, ev.Winning, ev.Raw.BlockNumber, blockTime(ev.Raw.BlockNumber))
+	return nil
+}
+
+// streakChange remembers what a Win or Loss did to a streak so a reorg can
+// undo it.
+type streakChange struct {
+	addr  string
+	prev  int
+	bonus bool
+	block uint64
+}
+
+// streakJournal is only touched from the event goroutine, like winStreaks.
+var streakJournal = map[common.Hash]streakChange{}
+
+// bonusTrigger keys the payout ledger. A play emits at most one Win, and the
+// transaction hash survives the Win being re-mined in another block.
+func bonusTrigger(l types.Log) string {
+	return l.TxHash.Hex()
+}
+
+func logID(l types.Log) common.Hash {
+	return crypto.Keccak256Hash(l.BlockHash.Bytes(), l.TxHash.Bytes(), new(big.Int).SetUint64(uint64(l.Index)).Bytes())
+}
+
+// bonusStreak is how many wins in a row earn a bonus.
+const bonusStreak = 3
+
+// winStreak returns a player's streak after one more win and whether that
+// win completes a bonus streak, which starts the count again. The live
+// handler and the backfill both count with it.
+func winStreak(streak int) (int, bool) {
+	if streak+1 >= bonusStreak {
+		return 0, true
+	}
+	return streak + 1, false
+}
+
+// setStreak updates a streak in memory and in the store.
+func setStreak(addr string, n int) {
+	winStreaks[addr] = n
+	if err := db.SetStreak(addr, n); err != nil {
+		log.Println("Failed to save streak:", err)
+	}
+}
+
+// journalStreak records change and forgets entries too old to be reorged.
+func journalStreak(l types.Log, change streakChange) {
+	streakJournal[logID(l)] = change
+	for id, old := range streakJournal {
+		if old.block+256 < l.BlockNumber {
+			delete(streakJournal, id)
+		}
+	}
+}
+
+func onWin(ev *game.GameWin) error {
+	history.ResolveWin(ev.Raw.TxHash, ev.Prize)
+
+	addr := ev.Player.Hex()
+	change := streakChange{addr: addr, prev: winStreaks[addr], block: ev.Raw.BlockNumber}
+	log.Println("Win for", addr, "- streak:", winStreaks[addr]+1)
+
+	// Nothing changes until the bonus is owed, so a failed Win can be
+	// handled again without counting twice.
+	streak, bonus := winStreak(winStreaks[addr])
+	if bonus {
+		if err := payoutEngine.Owe(bonusTrigger(ev.Raw), ev.Player, cfg.BonusAmount); err != nil {
+			return err
+		}
+		log.Println("Bonus owed to", addr, "for tx", ev.Raw.TxHash.Hex())
+		change.bonus = true
+	}
+	setStreak(addr, streak)
+	journalStreak(ev.Raw, change)
+	return nil
+}
+
+func onLoss(ev *game.GameLoss) error {
+	history.ResolveLoss(ev.Raw.TxHash)
+
+	addr := ev.Player.Hex()
+	journalStreak(ev.Raw, streakChange{addr: addr, prev: winStreaks[addr], block: ev.Raw.BlockNumber})
+	setStreak(addr, 0)
+	log.Println("Loss for", addr, "- streak reset")
+	return nil
+}
+
+func onBetPlacedRemoved(ev *game.GameBetPlaced) error {
+	history.Unresolve(ev.Raw.TxHash)
+	return nil
+}
+
+func onWinRemoved(ev *game.GameWin) error {
+	return undoStreak(ev.Raw)
+}
+
+func onLossRemoved(ev *game.GameLoss) error {
+	return undoStreak(ev.Raw)
+}
+
+// undoStreak reverts a Win or Loss. Removals arrive newest first, so
+// restoring the previous value walks the streak back in order. A bonus that
+// is still owed is cancelled; one that was already sent cannot be taken
+// back, so the streak is left at zero and the same wins do not pay twice.
+func undoStreak(raw types.Log) error {
+	history.Unresolve(raw.TxHash)
+
+	id := logID(raw)
+	change, ok := streakJournal[id]
+	if !ok {
+		return nil
+	}
+	delete(streakJournal, id)
+
+	if change.bonus {
+		cancelled, err := payoutEngine.Cancel(bonusTrigger(raw))
+		if err != nil {
+			return err
+		}
+		if !cancelled {
+			log.Println("Bonus already sent to", change.addr, "for a win that was reorged out")
+			setStreak(change.addr, 0)
+			return nil
+		}
+	}
+	setStreak(change.addr, change.prev)
+	log.Println("Streak for", change.addr, "rolled back to", change.prev)
+	return nil
+}
+
+func onTransfer(ev *token.TokenTransfer) error {
+	if ev.From != (common.Address{}) {
+		return nil
+	}
+	log.Println("Minted", ev.Value, "to", ev.To.Hex(), "tx:", ev.Raw.TxHash.Hex())
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return recordIssuance(ctx, ev)
+}
+
+func onTransferRemoved(ev *token.TokenTransfer) error {
+	if ev.From != (common.Address{}) {
+		return nil
+	}
+	return db.DeleteIssuance(ev.Raw.TxHash, ev.Raw.Index)
+}
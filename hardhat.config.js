@@ -4,6 +4,12 @@ require("@nomiclabs/hardhat-ethers");
 module.exports = {
   solidity: "0.8.20",
   networks: {
+    hardhat: process.env.MAINNET_FORK_URL
+      ? { forking: { url: process.env.MAINNET_FORK_URL } }
+      : {},
+    localhost: {
+      url: "http://127.0.0.1:8545"
+    },
     sepolia: {
       url: process.env.SEPOLIA_URL,
       accounts: [process.env.PRIVATE_KEY]
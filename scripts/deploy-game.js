@@ -3,7 +3,7 @@ const hre = require("hardhat");
 async function main() {
   const [deployer] = await hre.ethers.getSigners();
 
-  const tokenAddress = "0xa33239e13303Fe9586C25b70ABd4D5d65E7B368f";
+  const tokenAddress = process.env.TOKEN_ADDRESS || "0xa33239e13303Fe9586C25b70ABd4D5d65E7B368f";
   console.log("Using token at:", tokenAddress);
 
   const Game = await hre.ethers.getContractFactory("Game");